@@ -17,16 +17,28 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/lint/rules"
+	"helm.sh/helm/v3/pkg/lint/support"
+	"helm.sh/helm/v3/pkg/releaseutil"
 )
 
 const createDesc = `
@@ -48,16 +60,67 @@ something like this:
 do not exist, Helm will attempt to create them as it goes. If the given
 destination exists and there are files in that directory, conflicting files
 will be overwritten, but other files will be left alone.
+
+The default scaffold can be shaped with flags and presets, and with
+organization-wide defaults read from create-defaults.yaml in the Helm
+configuration directory. A chart can also be created from a starter or from
+the manifests of a deployed release. For example:
+
+    $ helm create foo --only deployment,service --probe grpc
+    $ helm create foo --preset webapp --chart-version 1.0.0
+    $ helm create foo --preset worker,pullsecret
+    $ helm create foo --starter mystarter
+    $ helm create foo --from-release legacy
+
+The presets, the preset definitions and create-defaults.yaml are described in
+docs/helm-create.md in the Helm repository.
 `
 
+// scaffoldFlags are the flags that shape the default scaffold and therefore
+// do not apply to a starter or a release.
+var scaffoldFlags = []string{"skip", "only", "ignore", "environments", "secrets", "vault", "workload-identity", "arch", "gpu", "spot", "preset", "otel", "log-sidecar", "persistence", "license-header", "artifacthub", "dependency", "fullname", "fullname-max-length", "fullname-hash", "probe", "tls"}
+
 type createOptions struct {
-	starter    string // --starter
+	starter    string   // --starter
+	ci         bool     // --ci
+	desc       string   // --description
+	version    string   // --chart-version
+	appVersion string   // --app-version
+	apiVersion string   // --api-version
+	home       string   // --home
+	keywords   []string // --keyword
+	maintainer []string // --maintainer
+	deps       []string // --dependency
+	fullname   string   // --fullname
+	maxLength  int      // --fullname-max-length
+	hash       bool     // --fullname-hash
+	skip       []string // --skip
+	only       []string // --only
+	ignore     []string // --ignore
+	envs       []string // --environments
+	secrets    string   // --secrets
+	vault      bool     // --vault
+	identity   string   // --workload-identity
+	arch       string   // --arch
+	gpu        string   // --gpu
+	spot       bool     // --spot
+	otel       bool     // --otel
+	logSidecar bool     // --log-sidecar
+	presets    []string // --preset
+	persist    bool     // --persistence
+	probe      string   // --probe
+	tls        bool     // --tls
+	release    string   // --from-release
+	header     string   // --license-header
+	hub        bool     // --artifacthub
 	name       string
+	origName   string
 	starterDir string
+	cfg        *action.Configuration
 }
 
-func newCreateCmd(out io.Writer) *cobra.Command {
-	o := &createOptions{}
+func newCreateCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	o := &createOptions{cfg: cfg}
 
 	cmd := &cobra.Command{
 		Use:   "create NAME",
@@ -74,13 +137,70 @@ func newCreateCmd(out io.Writer) *cobra.Command {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.starter != "" && o.release != "" {
+				return errors.New("--starter and --from-release cannot be used together")
+			}
+			source := ""
+			if o.starter != "" {
+				source = "starter"
+			} else if o.release != "" {
+				source = "from-release"
+			}
+			for _, name := range scaffoldFlags {
+				if source != "" && cmd.Flags().Changed(name) {
+					return errors.Errorf("--%s cannot be used with --%s", name, source)
+				}
+			}
 			o.name = args[0]
 			o.starterDir = helmpath.DataPath("starters")
+			if o.ci {
+				return o.runCI(out, cmd.ErrOrStderr())
+			}
+			if err := o.sanitizeName(); err != nil {
+				return err
+			}
 			return o.run(out)
 		},
 	}
 
 	cmd.Flags().StringVarP(&o.starter, "starter", "p", "", "the name or absolute path to Helm starter scaffold")
+	cmd.Flags().StringVar(&o.release, "from-release", "", "create the chart from the manifests of a deployed release")
+	err := cmd.RegisterFlagCompletionFunc("from-release", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return compListReleases(toComplete, nil, cfg)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	cmd.Flags().BoolVar(&o.ci, "ci", false, "never overwrite files, print the outcome as JSON and exit with a code telling failures apart")
+	cmd.Flags().StringVar(&o.desc, "description", "", "the description of the chart in Chart.yaml")
+	cmd.Flags().StringVar(&o.version, "chart-version", "", "the version of the chart in Chart.yaml")
+	cmd.Flags().StringVar(&o.appVersion, "app-version", "", "the version of the application in Chart.yaml")
+	cmd.Flags().StringVar(&o.apiVersion, "api-version", "", "the chart API version in Chart.yaml (v1, v2)")
+	cmd.Flags().StringVar(&o.fullname, "fullname", "", "the composition of the name of the generated resources (release-chart, chart-release, chart)")
+	cmd.Flags().IntVar(&o.maxLength, "fullname-max-length", 0, "the length the name of the generated resources is truncated to (at most 63)")
+	cmd.Flags().BoolVar(&o.hash, "fullname-hash", false, "end truncated names of the generated resources with a hash of the whole name")
+	cmd.Flags().StringArrayVar(&o.deps, "dependency", []string{}, "a dependency of the chart, as NAME@VERSION:REPOSITORY (can specify multiple)")
+	cmd.Flags().StringVar(&o.home, "home", "", "the URL of the home page of the project in Chart.yaml")
+	cmd.Flags().StringSliceVar(&o.keywords, "keyword", []string{}, "a keyword of the chart in Chart.yaml (can specify multiple or separate values with commas: web,nginx)")
+	cmd.Flags().StringArrayVar(&o.maintainer, "maintainer", []string{}, "a maintainer of the chart in Chart.yaml, as \"NAME <EMAIL>\" (can specify multiple)")
+	cmd.Flags().BoolVar(&o.hub, "artifacthub", false, "add the annotations read by Artifact Hub to Chart.yaml")
+	cmd.Flags().StringVar(&o.header, "license-header", "", "a license header, such as \"SPDX-License-Identifier: Apache-2.0\", at the top of every generated template")
+	cmd.Flags().StringVar(&o.identity, "workload-identity", "", "add service account annotations for the workload identity of a cloud provider (gke, eks, aks)")
+	cmd.Flags().BoolVar(&o.tls, "tls", false, "add an https container port serving TLS with the certificate of a Secret")
+	cmd.Flags().StringVar(&o.probe, "probe", "", "how the probes check the container (http, grpc, tcp, exec)")
+	cmd.Flags().BoolVar(&o.persist, "persistence", false, "add a PersistentVolumeClaim mounted into the application container")
+	cmd.Flags().BoolVar(&o.logSidecar, "log-sidecar", false, "add a fluent-bit sidecar shipping the log files of the application")
+	cmd.Flags().BoolVar(&o.otel, "otel", false, "add an OpenTelemetry Collector sidecar")
+	cmd.Flags().StringSliceVar(&o.presets, "preset", []string{}, fmt.Sprintf("add the templates and values of a preset to the default scaffold, or of a preset definition in the presets directory of Helm or a YAML file (can specify multiple or separate values with commas: %s)", strings.Join(chartutil.Presets, ",")))
+	cmd.Flags().BoolVar(&o.spot, "spot", false, "tolerate and prefer the nodes of spot or preemptible node pools")
+	cmd.Flags().StringVar(&o.gpu, "gpu", "", "request a GPU of the given vendor for the container (nvidia)")
+	cmd.Flags().StringVar(&o.arch, "arch", "", "schedule the pods on nodes of the given CPU architecture (amd64, arm64, arm, ppc64le, s390x)")
+	cmd.Flags().BoolVar(&o.vault, "vault", false, "add the Vault agent injector annotations to the pods, enabled in values")
+	cmd.Flags().StringVar(&o.secrets, "secrets", "", "keep sensitive values in a separate secrets.yaml for the given provider (sops)")
+	cmd.Flags().StringSliceVar(&o.envs, "environments", []string{}, "generate a values-<env>.yaml for each environment (can specify multiple or separate values with commas: dev,prod)")
+	cmd.Flags().StringArrayVar(&o.ignore, "ignore", []string{}, "add a pattern to the generated .helmignore (can specify multiple)")
+	cmd.Flags().StringSliceVar(&o.only, "only", []string{}, "the only resources of the default scaffold to generate (can specify multiple or separate values with commas: deployment,service)")
+	cmd.Flags().StringSliceVar(&o.skip, "skip", []string{}, "resources of the default scaffold not to generate (can specify multiple or separate values with commas: ingress,hpa)")
 	return cmd
 }
 
@@ -97,17 +217,314 @@ func (o *createOptions) run(out io.Writer) error {
 		APIVersion:  chart.APIVersionV2,
 	}
 
-	if o.starter != "" {
-		// Create from the starter
-		lstarter := filepath.Join(o.starterDir, o.starter)
-		// If path is absolute, we don't want to prefix it with helm starters folder
-		if filepath.IsAbs(o.starter) {
-			lstarter = o.starter
+	if len(o.skip) > 0 && len(o.only) > 0 {
+		return errors.New("--skip and --only cannot be used together")
+	}
+
+	maintainers := make([]*chart.Maintainer, len(o.maintainer))
+	for i, m := range o.maintainer {
+		maintainer, err := parseMaintainer(m)
+		if err != nil {
+			return err
+		}
+		maintainers[i] = maintainer
+	}
+
+	deps := make([]*chart.Dependency, len(o.deps))
+	for i, d := range o.deps {
+		dep, err := parseDependency(d)
+		if err != nil {
+			return err
 		}
-		return chartutil.CreateFrom(cfile, filepath.Dir(o.name), lstarter)
+		deps[i] = dep
+	}
+
+	copts := chartutil.CreateOptions{
+		Description:      o.desc,
+		Version:          o.version,
+		AppVersion:       o.appVersion,
+		APIVersion:       o.apiVersion,
+		Home:             o.home,
+		Keywords:         o.keywords,
+		Maintainers:      maintainers,
+		Dependencies:     deps,
+		Fullname:         o.fullname,
+		FullnameLength:   o.maxLength,
+		FullnameHash:     o.hash,
+		Skip:             o.skip,
+		Only:             o.only,
+		Presets:          o.presets,
+		Ignore:           o.ignore,
+		Environments:     o.envs,
+		Secrets:          o.secrets,
+		Vault:            o.vault,
+		WorkloadIdentity: o.identity,
+		Arch:             o.arch,
+		GPU:              o.gpu,
+		Spot:             o.spot,
+		Otel:             o.otel,
+		LogSidecar:       o.logSidecar,
+		Persistence:      o.persist,
+		Probe:            o.probe,
+		TLS:              o.tls,
+		LicenseHeader:    o.header,
+		ArtifactHub:      o.hub,
+		OriginalName:     o.origName,
+		Check:            duplicateResources,
+		Warnings:         out,
+	}
+	defaults, err := chartutil.LoadCreateDefaults(helmpath.ConfigPath(chartutil.CreateDefaultsFileName))
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		if o.release == "" && o.starter == "" {
+			return err
+		}
+		// Only the required labels and annotations apply to the other ways
+		// to create a chart, so a mistake in the defaults does not get in
+		// their way.
+		fmt.Fprintf(out, "WARNING: The labels and annotations required by %s are not added: %s\n", chartutil.CreateDefaultsFileName, err)
+		defaults = nil
+	}
+	fopts := chartutil.CreateFromOptions{Check: duplicateResources, Warnings: out}
+	if defaults != nil {
+		fopts.RequiredLabels = defaults.RequiredLabels
+		fopts.RequiredAnnotations = defaults.RequiredAnnotations
+	}
+	if o.release != "" {
+		return o.createFromRelease(cfile, copts, fopts)
+	}
+	if o.starter != "" {
+		copts.ApplyMetadata(cfile)
+		return chartutil.CreateFromWithOptions(cfile, filepath.Dir(o.name), o.starterPath(), fopts)
+	}
+
+	if defaults != nil {
+		copts.Defaults = *defaults
+	}
+	if err := o.loadPresets(&copts); err != nil {
+		return err
 	}
 
-	chartutil.Stderr = out
-	_, err := chartutil.Create(chartname, filepath.Dir(o.name))
+	_, err = chartutil.CreateWithOptions(chartname, filepath.Dir(o.name), copts)
 	return err
 }
+
+// loadPresets loads the definitions of the presets that are not presets of
+// the default scaffold, and of those they build on, either from a path to a
+// YAML file or by name from the presets directory of Helm.
+func (o *createOptions) loadPresets(copts *chartutil.CreateOptions) error {
+	builtin := map[string]bool{}
+	for _, name := range chartutil.Presets {
+		builtin[name] = true
+	}
+	loaded := map[string]bool{}
+	names := append([]string{}, copts.Presets...)
+	for i := 0; i < len(names); i++ {
+		name := names[i]
+		if builtin[name] || loaded[name] {
+			continue
+		}
+		filename := name
+		if !strings.HasSuffix(name, ".yaml") {
+			filename = helmpath.DataPath("presets", name+".yaml")
+		}
+		def, err := chartutil.LoadPresetDefinition(filename)
+		if os.IsNotExist(errors.Cause(err)) {
+			// Left to CreateWithOptions, which lists the known presets.
+			continue
+		} else if err != nil {
+			return err
+		}
+		if i < len(copts.Presets) {
+			copts.Presets[i] = def.Name
+		}
+		loaded[name], loaded[def.Name] = true, true
+		copts.PresetDefinitions = append(copts.PresetDefinitions, def)
+		names = append(names, def.Presets...)
+	}
+	return nil
+}
+
+// duplicateResources renders the chart in dir with its default values, as
+// helm lint does, and returns the resources that more than one of its
+// templates renders, which would fail the install.
+func duplicateResources(dir string) []string {
+	linter := support.Linter{ChartDir: dir}
+	rules.Templates(&linter, nil, settings.Namespace(), false)
+	var problems []string
+	for _, msg := range linter.Messages {
+		if errors.As(msg.Err, &rules.ErrDuplicateResource{}) {
+			problems = append(problems, fmt.Sprintf("%s: %s", msg.Path, msg.Err))
+		}
+	}
+	return problems
+}
+
+// sanitizeName turns a chart name with characters outside of ASCII into a
+// valid one, keeping the name asked for.
+func (o *createOptions) sanitizeName() error {
+	base := filepath.Base(o.name)
+	if strings.IndexFunc(base, func(r rune) bool { return r > unicode.MaxASCII }) < 0 {
+		return nil
+	}
+	name, err := chartutil.SanitizeChartName(base)
+	if err != nil {
+		return err
+	}
+	o.origName = base
+	o.name = filepath.Join(filepath.Dir(o.name), name)
+	return nil
+}
+
+// createFromRelease creates the chart from the manifests of the release given
+// with --from-release.
+func (o *createOptions) createFromRelease(cfile *chart.Metadata, copts chartutil.CreateOptions, fopts chartutil.CreateFromOptions) error {
+	rel, err := action.NewGet(o.cfg).Run(o.release)
+	if err != nil {
+		return err
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil && rel.Chart.Metadata.AppVersion != "" {
+		cfile.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	copts.ApplyMetadata(cfile)
+
+	split := releaseutil.SplitManifests(rel.Manifest)
+	keys := make([]string, 0, len(split))
+	for k := range split {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+	manifests := make([]string, len(keys))
+	for i, k := range keys {
+		manifests[i] = split[k]
+	}
+	return chartutil.CreateFromManifestsWithOptions(cfile, filepath.Dir(o.name), rel.Name, manifests, fopts)
+}
+
+// starterPath returns the path of the starter to create the chart from.
+func (o *createOptions) starterPath() string {
+	// If path is absolute, we don't want to prefix it with helm starters folder
+	if filepath.IsAbs(o.starter) {
+		return o.starter
+	}
+	return filepath.Join(o.starterDir, o.starter)
+}
+
+// Exit codes of 'helm create --ci' telling failures apart. Other failures
+// exit with 1.
+const (
+	createExitExists   = 2
+	createExitInvalid  = 3
+	createExitNotFound = 4
+)
+
+// createFailureReasons names the failures of 'helm create --ci' by exit code.
+var createFailureReasons = map[int]string{
+	1:                  "error",
+	createExitExists:   "exists",
+	createExitInvalid:  "invalid",
+	createExitNotFound: "not-found",
+}
+
+// createResult is the outcome of 'helm create --ci', printed as JSON.
+type createResult struct {
+	Chart  string `json:"chart"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// exitError makes helm exit with code instead of 1.
+type exitError struct {
+	error
+	code int
+}
+
+// runCI creates the chart without overwriting anything, writing the progress
+// messages to errOut and the outcome as JSON to out.
+func (o *createOptions) runCI(out, errOut io.Writer) error {
+	err := o.sanitizeName()
+	if err == nil {
+		err = o.checkCI()
+	}
+	if err == nil {
+		err = o.run(errOut)
+	}
+
+	result := createResult{Chart: o.name}
+	code := 0
+	if err != nil {
+		code = 1
+		switch e := errors.Cause(err).(type) {
+		case exitError:
+			code = e.code
+		case chartutil.ErrInvalidGeneratedChart, chartutil.ErrNameInvalid,
+			chartutil.ErrUnknownScaffoldResource, chartutil.ErrDependencyValuesConflict:
+			code = createExitInvalid
+		case chartutil.ErrChartNotFound:
+			code = createExitNotFound
+		}
+		result.Error = err.Error()
+		result.Reason = createFailureReasons[code]
+	}
+	if err := json.NewEncoder(out).Encode(result); err != nil {
+		return err
+	}
+	if err != nil {
+		return exitError{err, code}
+	}
+	return nil
+}
+
+// checkCI fails when the chart would overwrite files or its starter does not
+// exist.
+func (o *createOptions) checkCI() error {
+	if fi, err := os.Stat(o.name); err == nil {
+		if !fi.IsDir() {
+			return exitError{errors.Errorf("%s already exists and is not a directory", o.name), createExitExists}
+		}
+		entries, err := ioutil.ReadDir(o.name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return exitError{errors.Errorf("%s already exists and is not empty", o.name), createExitExists}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if o.starter != "" {
+		if _, err := os.Stat(o.starterPath()); os.IsNotExist(err) {
+			return exitError{errors.Errorf("starter %s not found", o.starter), createExitNotFound}
+		}
+	}
+	return nil
+}
+
+// parseMaintainer parses a maintainer given as "NAME" or "NAME <EMAIL>".
+func parseMaintainer(s string) (*chart.Maintainer, error) {
+	m := &chart.Maintainer{Name: strings.TrimSpace(s)}
+	if i := strings.Index(s, "<"); i >= 0 {
+		if !strings.HasSuffix(strings.TrimSpace(s), ">") {
+			return nil, errors.Errorf("invalid maintainer %q, expected NAME <EMAIL>", s)
+		}
+		m.Name = strings.TrimSpace(s[:i])
+		m.Email = strings.TrimSuffix(strings.TrimSpace(s[i+1:]), ">")
+	}
+	if m.Name == "" {
+		return nil, errors.Errorf("invalid maintainer %q, the name is missing", s)
+	}
+	return m, nil
+}
+
+// parseDependency parses a dependency given as NAME@VERSION:REPOSITORY, such as
+// "postgresql@12.x:https://charts.bitnami.com/bitnami".
+func parseDependency(s string) (*chart.Dependency, error) {
+	name, rest := s, ""
+	if i := strings.Index(s, "@"); i >= 0 {
+		name, rest = s[:i], s[i+1:]
+	}
+	i := strings.Index(rest, ":")
+	if name == "" || i <= 0 || i == len(rest)-1 {
+		return nil, errors.Errorf("invalid dependency %q, expected NAME@VERSION:REPOSITORY", s)
+	}
+	return &chart.Dependency{Name: name, Version: rest[:i], Repository: rest[i+1:]}, nil
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"helm.sh/helm/v3/internal/test/ensure"
@@ -28,6 +31,7 @@ import (
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/release"
 )
 
 func TestCreateCmd(t *testing.T) {
@@ -61,6 +65,1689 @@ func TestCreateCmd(t *testing.T) {
 	}
 }
 
+func TestCreateMetadataCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --description 'An example: chart' --chart-version 1.2.3 --app-version 1.0 --api-version v1 " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	c, err := loader.LoadDir(cname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Metadata.Description != "An example: chart" {
+		t.Errorf("Wrong description: %q", c.Metadata.Description)
+	}
+	if c.Metadata.Version != "1.2.3" {
+		t.Errorf("Wrong version: %q", c.Metadata.Version)
+	}
+	if c.Metadata.AppVersion != "1.0" {
+		t.Errorf("Wrong app version: %q", c.Metadata.AppVersion)
+	}
+	if c.Metadata.APIVersion != chart.APIVersionV1 {
+		t.Errorf("Wrong API version: %q", c.Metadata.APIVersion)
+	}
+
+	if _, _, err := executeActionCommand("create --chart-version latest " + cname + "2"); err == nil {
+		t.Error("Expected an error for a chart version that is not a semantic version")
+	}
+}
+
+func TestCreateMaintainerCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --home https://example.com --keyword web,nginx --maintainer 'Jane Doe <jane@example.com>' --maintainer John " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	c, err := loader.LoadDir(cname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Metadata.Home != "https://example.com" {
+		t.Errorf("Wrong home: %q", c.Metadata.Home)
+	}
+	if len(c.Metadata.Keywords) != 2 || c.Metadata.Keywords[1] != "nginx" {
+		t.Errorf("Wrong keywords: %v", c.Metadata.Keywords)
+	}
+	expect := []chart.Maintainer{{Name: "Jane Doe", Email: "jane@example.com"}, {Name: "John"}}
+	if len(c.Metadata.Maintainers) != len(expect) {
+		t.Fatalf("Wrong maintainers: %v", c.Metadata.Maintainers)
+	}
+	for i, m := range c.Metadata.Maintainers {
+		if *m != expect[i] {
+			t.Errorf("Expected maintainer %v, got %v", expect[i], *m)
+		}
+	}
+
+	if _, _, err := executeActionCommand("create --maintainer 'Jane <jane@example.com' " + cname + "2"); err == nil {
+		t.Error("Expected an error for an invalid maintainer")
+	}
+}
+
+func TestCreateLicenseHeaderCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --license-header 'SPDX-License-Identifier: Apache-2.0' " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "SPDX") {
+		t.Error("Expected the license header not to be rendered")
+	}
+	if !strings.Contains(out, "---\n# Source: testchart/templates/service.yaml\napiVersion: v1\n") {
+		t.Error("Expected the rendered manifests to be unchanged by the license header")
+	}
+}
+
+func TestCreateDependencyCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --dependency postgresql@12.x:https://charts.bitnami.com/bitnami " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	c, err := loader.LoadDir(cname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := c.Metadata.Dependencies
+	if len(deps) != 1 {
+		t.Fatalf("Expected 1 dependency, got %d", len(deps))
+	}
+	for _, f := range [][2]string{
+		{deps[0].Name, "postgresql"},
+		{deps[0].Version, "12.x"},
+		{deps[0].Repository, "https://charts.bitnami.com/bitnami"},
+		{deps[0].Condition, "postgresql.enabled"},
+	} {
+		if f[0] != f[1] {
+			t.Errorf("Expected %q, got %q", f[1], f[0])
+		}
+	}
+
+	for _, dep := range []string{"postgresql", "postgresql@12.x", "@12.x:https://charts.bitnami.com/bitnami", "postgresql@12.x:"} {
+		if _, _, err := executeActionCommand("create --dependency " + dep + " " + cname + "2"); err == nil {
+			t.Errorf("Expected an error for dependency %q", dep)
+		}
+	}
+}
+
+func TestCreateFullnameCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	for _, tt := range []struct {
+		flags  string
+		expect string
+	}{
+		{"", "\n  name: release-name-testchart\n"},
+		{"--fullname chart-release", "\n  name: testchart-release-name\n"},
+		{"--fullname chart", "\n  name: testchart\n"},
+		{"--fullname chart-release --fullname-max-length 12", "\n  name: testchart-re\n"},
+		{"--fullname chart-release --fullname-max-length 12 --fullname-hash", "\n  name: tes-541490bd\n"},
+		{"--fullname-hash", "\n  name: release-name-testchart\n"},
+	} {
+		cname := "testchart"
+		if _, _, err := executeActionCommand("create " + tt.flags + " " + cname); err != nil {
+			t.Fatalf("Failed to run create: %s", err)
+		}
+		_, out, err := executeActionCommand("template " + cname + " --show-only templates/service.yaml")
+		if err != nil {
+			t.Fatalf("Failed to render chart: %s", err)
+		}
+		if !strings.Contains(out, tt.expect) {
+			t.Errorf("%q: expected %q in the rendered service", tt.flags, tt.expect)
+		}
+		if err := os.RemoveAll(cname); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateCICmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	result := func(out string) createResult {
+		t.Helper()
+		var r createResult
+		if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):strings.Index(out, "}")+1]), &r); err != nil {
+			t.Fatalf("Expected a JSON result, got %q: %s", out, err)
+		}
+		return r
+	}
+
+	_, out, err := executeActionCommand("create --ci " + cname)
+	if err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+	if r := result(out); r.Chart != cname || r.Error != "" {
+		t.Errorf("Unexpected result %+v", r)
+	}
+
+	for _, tt := range []struct {
+		args   string
+		code   int
+		reason string
+	}{
+		{cname, createExitExists, "exists"},
+		{"--starter missing " + cname + "2", createExitNotFound, "not-found"},
+	} {
+		_, out, err := executeActionCommand("create --ci " + tt.args)
+		e, ok := err.(exitError)
+		if !ok || e.code != tt.code {
+			t.Errorf("%s: expected exit code %d, got %v", tt.args, tt.code, err)
+		}
+		if r := result(out); r.Reason != tt.reason {
+			t.Errorf("%s: expected reason %q, got %q", tt.args, tt.reason, r.Reason)
+		}
+	}
+}
+
+func TestCreateSkipCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	for i, skip := range []string{
+		"ingress,hpa,serviceaccount,tests",
+		"service,ingress,tests",
+		"serviceaccount",
+	} {
+		cname := fmt.Sprintf("testchart%d", i)
+		if _, _, err := executeActionCommand(fmt.Sprintf("create %s --skip %s", cname, skip)); err != nil {
+			t.Fatalf("Failed to run create --skip %s: %s", skip, err)
+		}
+
+		// The remaining templates must still render with the trimmed values.
+		if _, _, err := executeActionCommand(fmt.Sprintf("template %s", cname)); err != nil {
+			t.Errorf("Failed to render chart created with --skip %s: %s", skip, err)
+		}
+	}
+
+	if _, _, err := executeActionCommand("create broken --skip service"); err == nil {
+		t.Error("Expected an error skipping a resource the ingress depends on")
+	}
+}
+
+func TestCreateOnlyCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname + " --only deployment,service"); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	c, err := loader.LoadDir(cname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// deployment, service, NOTES.txt and _helpers.tpl
+	if l := len(c.Templates); l != 4 {
+		t.Errorf("Expected 4 templates, got %d", l)
+	}
+
+	if _, _, err := executeActionCommand("template " + cname); err != nil {
+		t.Errorf("Failed to render chart: %s", err)
+	}
+
+	if _, _, err := executeActionCommand("create other --only deployment --skip tests"); err == nil {
+		t.Error("Expected an error combining --only and --skip")
+	}
+}
+
+func TestCreateCommonMetadataCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand(fmt.Sprintf("template %s --set commonLabels.team=platform --set commonAnnotations.owner=platform --set ingress.enabled=true", cname))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	// The service account, service, deployment, ingress and test pod.
+	if n := strings.Count(out, "team: platform"); n != 5 {
+		t.Errorf("Expected the common label 5 times, got %d", n)
+	}
+	if n := strings.Count(out, "owner: platform"); n != 5 {
+		t.Errorf("Expected the common annotation 5 times, got %d", n)
+	}
+}
+
+func TestCreateImageDigestCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	_, out, err := executeActionCommand(fmt.Sprintf("template %s --set image.tag=1.0 --set image.digest=%s", cname, digest))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, `image: "nginx@`+digest+`"`) {
+		t.Error("Expected the image to be pinned by digest")
+	}
+
+	_, out, err = executeActionCommand(fmt.Sprintf("template %s --set image.tag=1.0", cname))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, `image: "nginx:1.0"`) {
+		t.Error("Expected the image to use the tag without a digest")
+	}
+}
+
+func TestCreateRevisionHistoryCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "revisionHistoryLimit: 3\n  progressDeadlineSeconds: 600\n") {
+		t.Error("Expected the default revision history limit and progress deadline")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set revisionHistoryLimit=1 --set progressDeadlineSeconds=120")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "revisionHistoryLimit: 1\n  progressDeadlineSeconds: 120\n") {
+		t.Error("Expected the revision history limit and progress deadline from values")
+	}
+}
+
+func TestCreateStrategyCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set strategy.rollingUpdate.maxUnavailable=0")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "strategy:\n    type: RollingUpdate\n    rollingUpdate:\n      maxSurge: 25%\n      maxUnavailable: 0\n") {
+		t.Error("Expected a rolling update strategy from values")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set strategy.type=Recreate")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "strategy:\n    type: Recreate\n  selector:") {
+		t.Error("Expected a Recreate strategy without rollingUpdate")
+	}
+}
+
+func TestCreateMeshInjectionCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "inject") {
+		t.Error("Expected no mesh injection settings unless mesh.provider is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set mesh.provider=istio")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "app.kubernetes.io/instance: release-name\n        sidecar.istio.io/inject: \"true\"\n") {
+		t.Error("Expected the istio injection label on the pods")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set mesh.provider=linkerd --set mesh.inject=false")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "annotations:\n        linkerd.io/inject: disabled\n") {
+		t.Error("Expected the linkerd injection annotation on the pods")
+	}
+
+	if _, _, err := executeActionCommand("template " + cname + " --set mesh.provider=consul"); err == nil {
+		t.Error("Expected an error for an unknown mesh provider")
+	}
+}
+
+func TestCreateServiceProtocolCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "appProtocol") {
+		t.Error("Expected no appProtocol unless service.appProtocol is set")
+	}
+	if n := strings.Count(out, "protocol: TCP"); n != 2 {
+		t.Errorf("Expected the TCP protocol on the service and the container, got %d", n)
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set service.protocol=UDP --set service.appProtocol=kubernetes.io/h2c")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if n := strings.Count(out, "protocol: UDP"); n != 2 {
+		t.Errorf("Expected the UDP protocol on the service and the container, got %d", n)
+	}
+	if !strings.Contains(out, "appProtocol: kubernetes.io/h2c") {
+		t.Error("Expected the appProtocol of the service port")
+	}
+}
+
+func TestCreatePullSecretCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset pullsecret " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kubernetes.io/dockerconfigjson") || strings.Contains(out, "imagePullSecrets") {
+		t.Error("Expected no image pull secret unless imageCredentials.create is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set imageCredentials.create=true --set imageCredentials.registry=registry.example.com --set imageCredentials.username=user --set imageCredentials.password=secret")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "type: kubernetes.io/dockerconfigjson") {
+		t.Error("Expected a kubernetes.io/dockerconfigjson secret")
+	}
+	if !strings.Contains(out, "imagePullSecrets:\n        - name: release-name-testchart-pull") {
+		t.Error("Expected the pods to pull the image with the generated secret")
+	}
+
+	if _, _, err := executeActionCommand("template " + cname + " --set imageCredentials.create=true"); err == nil {
+		t.Error("Expected an error when imageCredentials.registry is empty")
+	}
+
+	// The credentials are filled in in credentials.yaml and passed with -f.
+	credentials := filepath.Join(cname, chartutil.CredentialsValuesfileName)
+	if err := ioutil.WriteFile(credentials, []byte("imageCredentials:\n  username: user\n  password: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, out, err = executeActionCommand("template " + cname + " -f " + credentials + " --set imageCredentials.create=true,imageCredentials.registry=registry.example.com")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	config := base64.StdEncoding.EncodeToString([]byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpzZWNyZXQ=","password":"secret","username":"user"}}}`))
+	if !strings.Contains(out, ".dockerconfigjson: "+config) {
+		t.Errorf("Expected the docker config of the credentials in credentials.yaml, got\n%s", out)
+	}
+}
+
+func TestCreateVaultCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --vault " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "vault.hashicorp.com") {
+		t.Error("Expected no Vault annotations unless vault.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set vault.enabled=true --set mesh.provider=linkerd")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"        linkerd.io/inject: enabled\n",
+		"        vault.hashicorp.com/agent-inject: \"true\"\n",
+		"        vault.hashicorp.com/role: \"testchart\"\n",
+		"        vault.hashicorp.com/agent-inject-secret-config: \"secret/data/testchart/config\"\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the pod annotations, got:\n%s", expect, out)
+		}
+	}
+}
+
+func TestCreatePodMonitorCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset podmonitor --only deployment " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kind: PodMonitor") {
+		t.Error("Expected no PodMonitor unless podMonitor.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set podMonitor.enabled=true --set podMonitor.labels.release=prometheus")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "kind: PodMonitor") {
+		t.Error("Expected a PodMonitor")
+	}
+	if !strings.Contains(out, "labels:\n    release: prometheus\n") {
+		t.Error("Expected the PodMonitor to carry podMonitor.labels")
+	}
+}
+
+func TestCreateOperatorCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset operator " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, kind := range []string{"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"} {
+		if !strings.Contains(out, "kind: "+kind+"\n") {
+			t.Errorf("Expected a %s", kind)
+		}
+	}
+	if strings.Contains(out, "kind: ValidatingWebhookConfiguration") {
+		t.Error("Expected no webhook unless webhook.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set webhook.enabled=true")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"kind: ValidatingWebhookConfiguration",
+		"/release-name-testchart-webhook\n",
+		"name: release-name-testchart-webhook.",
+		"containerPort: 9443\n",
+		"secretName: release-name-testchart-webhook-cert\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateHookJobCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset hookjob " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kind: Job") {
+		t.Error("Expected no Job unless hookJob.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set hookJob.enabled=true --set hookJob.phase=pre-install")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"kind: Job",
+		"name: release-name-testchart-hook\n",
+		"\"helm.sh/hook\": pre-install\n",
+		"\"helm.sh/hook-weight\": \"-1\"\n",
+		"serviceAccountName: release-name-testchart-hook\n",
+		"app.kubernetes.io/name: testchart-hook\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateMigrationCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset migration " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set migration.enabled=true --set image.tag=1.2.3")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"name: release-name-testchart-migration\n",
+		"\"helm.sh/hook\": pre-install,pre-upgrade\n",
+		"activeDeadlineSeconds: 300\n",
+		"image: \"nginx:1.2.3\"\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+	if strings.Count(out, "image: \"nginx:1.2.3\"\n") != 2 {
+		t.Error("Expected the migration to run the image of the deployment")
+	}
+}
+
+func TestCreateMigrationEnvCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset migration --otel " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set migration.enabled=true" +
+		" --set env[0].name=MODE,env[0].value=serve,env[1].name=DATABASE,env[1].value=shared" +
+		" --set migration.env[0].name=MODE,migration.env[0].value=migrate" +
+		" --set envFrom[0].configMapRef.name=settings")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for expect, count := range map[string]int{
+		"value: serve\n":                      1,
+		"value: migrate\n":                    1,
+		"value: shared\n":                     2,
+		"name: settings\n":                    2,
+		"name: OTEL_EXPORTER_OTLP_ENDPOINT\n": 1,
+	} {
+		if n := strings.Count(out, expect); n != count {
+			t.Errorf("Expected %q %d times in the rendered chart, got %d", expect, count, n)
+		}
+	}
+}
+
+func TestCreateCanaryCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset canary " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "canary") {
+		t.Error("Expected no canary while it is disabled")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set canary.enabled=true --set canary.tag=2.0.0 --set canary.replicaCount=2 --set ingress.enabled=true --set image.tag=1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for expect, count := range map[string]int{
+		"kind: Deployment\n":                                  2,
+		"kind: Service\n":                                     2,
+		"kind: Ingress\n":                                     2,
+		"name: release-name-testchart-canary\n":               4,
+		"image: \"nginx:1.0.0\"\n":                            1,
+		"image: \"nginx:2.0.0\"\n":                            1,
+		"replicas: 2\n":                                       1,
+		"track: canary\n":                                     3,
+		"nginx.ingress.kubernetes.io/canary-weight: \"10\"\n": 1,
+	} {
+		if n := strings.Count(out, expect); n != count {
+			t.Errorf("Expected %q %d times in the rendered chart, got %d", expect, count, n)
+		}
+	}
+}
+
+func TestCreateBlueGreenCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset bluegreen " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set blueGreen.active=green --set blueGreen.green.tag=2.0.0")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if n := strings.Count(out, "kind: Deployment\n"); n != 2 {
+		t.Errorf("Expected 2 deployments, got %d", n)
+	}
+	for _, expect := range []string{
+		"name: release-name-testchart-blue\n",
+		"name: release-name-testchart-green\n",
+		"image: \"nginx:0.1.0\"\n",
+		"image: \"nginx:2.0.0\"\n",
+		"    app.kubernetes.io/instance: release-name\n    color: green\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+
+	if _, _, err := executeActionCommand("template " + cname + " --set blueGreen.active=red"); err == nil {
+		t.Error("Expected an error for an unknown active color")
+	}
+}
+
+func TestCreateWebAppCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset webapp " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"kind: Deployment\n",
+		"kind: Service\n",
+		"kind: ServiceAccount\n",
+		"kind: Ingress\n",
+		"kind: HorizontalPodAutoscaler\n",
+		"cpu: 100m\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateWorkerCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset worker " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kind: Service\n") || strings.Contains(out, "livenessProbe") {
+		t.Error("Expected no service and no probes")
+	}
+	if !strings.Contains(out, "terminationGracePeriodSeconds: 60\n") {
+		t.Error("Expected the pods to be given 60 seconds to stop")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set livenessProbe.exec.command={cat,/tmp/healthy}")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "livenessProbe:\n            exec:\n") {
+		t.Error("Expected the liveness probe from values")
+	}
+}
+
+func TestCreateCronCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset cron " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set 'cron.schedule=*/5 * * * *'")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kind: Deployment") {
+		t.Error("Expected no deployment")
+	}
+	for _, expect := range []string{
+		"kind: CronJob",
+		"kind: ConfigMap",
+		"schedule: \"*/5 * * * *\"\n",
+		"serviceAccountName: release-name-testchart\n",
+		"mountPath: /etc/testchart\n",
+		"config.yaml: |\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateCronImageCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defaults := "imageRegistry: registry.example.com\nimagePullPolicy: Always\n"
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := executeActionCommand("create --preset cron,pullsecret " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set imageCredentials.create=true,imageCredentials.registry=registry.example.com" +
+		" --set imagePullSecrets[0].name=shared")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"image: \"registry.example.com/busybox:1.36\"\n",
+		"imagePullPolicy: Always\n",
+		"imagePullSecrets:\n            - name: shared\n            - name: release-name-testchart-pull\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateStatefulCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset stateful " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set volumeClaim.size=20Gi")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kind: Deployment") {
+		t.Error("Expected no deployment")
+	}
+	for _, expect := range []string{
+		"kind: StatefulSet\n",
+		"serviceName: release-name-testchart-headless\n",
+		"clusterIP: None\n",
+		"storage: \"20Gi\"\n",
+		"mountPath: /data\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateConsumerCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --preset consumer " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname + " --set keda.trigger.metadata.queueName=orders --set keda.connection.host=amqp://rabbitmq:5672/")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, unexpected := range []string{"kind: Service\n", "replicas:", "containerPort"} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("Expected no %q in the rendered chart", unexpected)
+		}
+	}
+	for _, expect := range []string{
+		"kind: ScaledObject\n",
+		"kind: TriggerAuthentication\n",
+		"queueName: orders\n",
+		"host: \"YW1xcDovL3JhYmJpdG1xOjU2NzIv\"\n",
+		"- parameter: host\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreatePresetDefinitionCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if err := os.MkdirAll(helmpath.DataPath("presets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	def := "name: acme-microservice\nresources: [deployment, service, serviceaccount]\npresets: [pullsecret]\nvalues:\n  service.port: 8080\nfiles:\n  templates/deployment.yaml: templates/api.yaml\n"
+	if err := ioutil.WriteFile(helmpath.DataPath("presets", "acme-microservice.yaml"), []byte(def), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := executeActionCommand("create --preset acme-microservice " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{"# Source: testchart/templates/api.yaml\n", "port: 8080\n", "kind: Secret\n"} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+	if strings.Contains(out, "kind: Ingress\n") {
+		t.Error("Expected no ingress")
+	}
+
+	if _, _, err := executeActionCommand("create --preset acme-frontend other"); err == nil || !strings.Contains(err.Error(), "unknown preset") {
+		t.Errorf("Expected an unknown preset error, got %v", err)
+	}
+}
+
+func TestCreateOtelCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --otel " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "otel") {
+		t.Error("Expected no collector unless otel.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set otel.enabled=true --set otel.exporter.endpoint=collector.example.com:4317")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"- name: otel-collector",
+		"name: OTEL_EXPORTER_OTLP_ENDPOINT",
+		"endpoint: collector.example.com:4317",
+		"name: release-name-testchart-otel",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+}
+
+func TestCreateLogSidecarCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --log-sidecar " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "fluent-bit") {
+		t.Error("Expected no log sidecar unless logSidecar.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set logSidecar.enabled=true")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"- name: fluent-bit",
+		"Path   /var/log/app/*.log",
+		"emptyDir: {}",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+	if n := strings.Count(out, "- name: app-logs"); n != 3 {
+		t.Errorf("Expected the log volume and its two mounts, got %d", n)
+	}
+}
+
+func TestCreateConfigChecksumCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --otel " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	checksum := func(set string) string {
+		_, out, err := executeActionCommand("template " + cname + " --set otel.enabled=true" + set)
+		if err != nil {
+			t.Fatalf("Failed to render chart: %s", err)
+		}
+		i := strings.Index(out, "checksum/config: ")
+		if i < 0 {
+			t.Fatal("Expected a checksum/config annotation on the pods")
+		}
+		return strings.SplitN(out[i:], "\n", 2)[0]
+	}
+	if checksum("") == checksum(" --set otel.exporter.endpoint=collector:4317") {
+		t.Error("Expected the checksum to change with the configuration")
+	}
+}
+
+func TestCreateProbeCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	for _, tt := range []struct {
+		probe  string
+		flags  string
+		expect string
+	}{
+		{"grpc", "--kube-version 1.24.0", "grpc:\n              port: 80\n"},
+		{"grpc", "", "tcpSocket:\n              port: http\n"},
+		{"tcp", "", "tcpSocket:\n              port: http\n"},
+		{"exec", "", "command:\n                - /bin/true\n"},
+	} {
+		cname := "testchart"
+		if _, _, err := executeActionCommand("create --probe " + tt.probe + " " + cname); err != nil {
+			t.Fatalf("Failed to run create: %s", err)
+		}
+		_, out, err := executeActionCommand("template " + cname + " " + tt.flags)
+		if err != nil {
+			t.Fatalf("Failed to render chart: %s", err)
+		}
+		if n := strings.Count(out, tt.expect); n != 2 {
+			t.Errorf("%s %s: expected the liveness and readiness probes to contain %q, got %d", tt.probe, tt.flags, tt.expect, n)
+		}
+		if strings.Contains(out, "httpGet") {
+			t.Errorf("%s %s: expected no HTTP probes", tt.probe, tt.flags)
+		}
+		if err := os.RemoveAll(cname); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := executeActionCommand("create --probe udp testchart"); err == nil {
+		t.Error("Expected an error for an unknown probe")
+	}
+}
+
+func TestCreateTLSCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --tls " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "https") {
+		t.Error("Expected no https port unless tls.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set tls.enabled=true --set tls.secretName=testchart-tls")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"- name: https\n              containerPort: 8443\n",
+		"targetPort: https\n",
+		"secretName: testchart-tls\n",
+		"mountPath: /etc/tls\n",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+	if n := strings.Count(out, "scheme: HTTPS"); n != 2 {
+		t.Errorf("Expected the liveness and readiness probes to use HTTPS, got %d", n)
+	}
+
+	if _, _, err := executeActionCommand("template " + cname + " --set tls.enabled=true"); err == nil {
+		t.Error("Expected an error without tls.secretName")
+	}
+}
+
+func TestCreatePersistenceCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --persistence " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "PersistentVolumeClaim") {
+		t.Error("Expected no persistent volume claim unless persistence.enabled is set")
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set persistence.enabled=true --set persistence.storageClass=-")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"kind: PersistentVolumeClaim",
+		`storageClassName: ""`,
+		`storage: "8Gi"`,
+		"mountPath: /data",
+		"claimName: release-name-testchart",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart", expect)
+		}
+	}
+
+	_, out, err = executeActionCommand("template " + cname + " --set persistence.enabled=true --set persistence.existingClaim=shared")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if strings.Contains(out, "kind: PersistentVolumeClaim") {
+		t.Error("Expected no persistent volume claim with an existing claim")
+	}
+	if !strings.Contains(out, "claimName: shared") {
+		t.Error("Expected the existing claim to be mounted")
+	}
+}
+
+func TestCreateArchCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --arch arm64 " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "nodeSelector:\n        kubernetes.io/arch: arm64") {
+		t.Error("Expected a kubernetes.io/arch node selector")
+	}
+	if !strings.Contains(out, "- effect: NoSchedule\n          key: kubernetes.io/arch\n          operator: Equal\n          value: arm64") {
+		t.Error("Expected a toleration of the kubernetes.io/arch taint")
+	}
+}
+
+func TestCreateGPUCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --gpu nvidia " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"runtimeClassName: nvidia",
+		"limits:\n              nvidia.com/gpu: 1",
+		"key: nvidia.com/gpu",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered deployment", expect)
+		}
+	}
+}
+
+func TestCreateSpotCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create --spot " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if !strings.Contains(out, "preferredDuringSchedulingIgnoredDuringExecution") {
+		t.Error("Expected the pods to prefer spot nodes")
+	}
+	if strings.Count(out, "node.kubernetes.io/lifecycle") != 2 {
+		t.Error("Expected the default spot node label in the affinity and the tolerations")
+	}
+}
+
+func TestCreateWithDefaultsCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defaults := "imageRegistry: registry.example.com\nport: 8080\nlabels:\n  example.com/team: platform\n"
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"image: \"registry.example.com/nginx:1.16.0\"",
+		"containerPort: 8080",
+		"example.com/team: platform",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected rendered chart to contain %q", expect)
+		}
+	}
+}
+
+func TestCreateRequiredPolicyCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defaults := "requiredLabels: [team]\nrequiredAnnotations: [example.com/tier]\n"
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := executeActionCommand("create " + cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	// A new chart renders with the placeholders.
+	_, out, err := executeActionCommand("template " + cname)
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	if n := strings.Count(out, `team: "changeme"`); n != 5 {
+		t.Errorf("Expected the team placeholder 5 times, got %d", n)
+	}
+	if _, _, err := executeActionCommand("template " + cname + " --set policy.labels.team="); err == nil {
+		t.Error("Expected rendering to fail with an empty policy value")
+	}
+
+	_, out, err = executeActionCommand(fmt.Sprintf("template %s --set policy.labels.team=platform --set 'policy.annotations.example\\.com/tier=gold'", cname))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	// The service account, service, deployment and its pods, and the test pod.
+	if n := strings.Count(out, `team: "platform"`); n != 5 {
+		t.Errorf("Expected the team label 5 times, got %d", n)
+	}
+	if n := strings.Count(out, `example.com/tier: "gold"`); n != 4 {
+		t.Errorf("Expected the tier annotation 4 times, got %d", n)
+	}
+}
+
+func TestCreateRequiredPolicyStarterCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	starter, err := chartutil.Create("starterchart", ensure.TempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defaults := "requiredLabels: [team]\nrequiredAnnotations: [example.com/tier]\n"
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := executeActionCommand(fmt.Sprintf("create --starter %s %s", starter, cname)); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	_, out, err := executeActionCommand(fmt.Sprintf("template %s --set policy.labels.team=platform --set 'policy.annotations.example\\.com/tier=gold'", cname))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	// The service account, service, deployment and its pods, and the test pod.
+	if n := strings.Count(out, `team: "platform"`); n != 5 {
+		t.Errorf("Expected the team label 5 times, got %d", n)
+	}
+	if n := strings.Count(out, `example.com/tier: "gold"`); n != 4 {
+		t.Errorf("Expected the tier annotation 4 times, got %d", n)
+	}
+}
+
+func TestCreateRequiredPolicyFromReleaseCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defaults := "requiredLabels: [team]\nrequiredAnnotations: [example.com/tier]\n"
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rel := release.Mock(&release.MockReleaseOptions{Name: "juno"})
+	rel.Manifest = `---
+# Source: legacy/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: juno-web
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.21
+`
+	store := storageFixture()
+	if err := store.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := executeActionCommandC(store, "create --from-release juno "+cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	if _, _, err := executeActionCommand("template " + cname + " --set policy.labels.team="); err == nil {
+		t.Error("Expected rendering to fail with an empty policy value")
+	}
+	_, out, err := executeActionCommand(fmt.Sprintf("template %s --set policy.labels.team=platform --set 'policy.annotations.example\\.com/tier=gold'", cname))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	// The deployment and its pods.
+	if n := strings.Count(out, `team: "platform"`); n != 2 {
+		t.Errorf("Expected the team label 2 times, got %d", n)
+	}
+	if n := strings.Count(out, `example.com/tier: "gold"`); n != 1 {
+		t.Errorf("Expected the tier annotation once, got %d", n)
+	}
+}
+
+// TestCreateAllOptionsCmd turns on every option of the default scaffold
+// together, so that one option moving the fragment another one is inserted
+// at does not go unnoticed.
+func TestCreateAllOptionsCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defaults := `imageRegistry: registry.example.com
+imagePullPolicy: Always
+labels:
+  example.com/owner: platform
+podAnnotations:
+  example.com/scrape: "true"
+port: 8080
+requiredLabels: [team]
+requiredAnnotations: [example.com/tier]
+valuesIndent: 4
+valuesComments: minimal
+valuesQuote: single
+templateIndent: 4
+`
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := []string{
+		"--artifacthub",
+		"--license-header 'SPDX-License-Identifier: Apache-2.0'",
+		"--workload-identity aks",
+		"--tls",
+		"--probe grpc",
+		"--persistence",
+		"--log-sidecar",
+		"--otel",
+		"--preset operator",
+		"--preset podmonitor",
+		"--spot",
+		"--gpu nvidia",
+		"--arch arm64",
+		"--preset pullsecret",
+		"--preset hookjob",
+		"--preset migration",
+		"--vault",
+		"--secrets sops",
+		"--environments dev,prod",
+	}
+	if _, _, err := executeActionCommand(fmt.Sprintf("create %s %s", strings.Join(flags, " "), cname)); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	sets := []string{
+		"tls.enabled=true",
+		"tls.secretName=testchart-tls",
+		"persistence.enabled=true",
+		"logSidecar.enabled=true",
+		"otel.enabled=true",
+		"webhook.enabled=true",
+		"podMonitor.enabled=true",
+		"imageCredentials.create=true",
+		"imageCredentials.registry=registry.example.com",
+		"imageCredentials.username=user",
+		"imageCredentials.password=secret",
+		"hookJob.enabled=true",
+		"migration.enabled=true",
+		"vault.enabled=true",
+		"secrets.token=secret",
+		"policy.labels.team=platform",
+	}
+	_, out, err := executeActionCommand(fmt.Sprintf("template %s --set %s", cname, strings.Join(sets, ",")))
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{
+		"example.com/owner: platform",
+		"example.com/scrape: \"true\"",
+		"team: \"platform\"",
+		"image: \"registry.example.com/nginx:",
+		"imagePullPolicy: Always",
+		"containerPort: 8080",
+		"name: https",
+		"grpc:",
+		"kind: PersistentVolumeClaim",
+		"fluent/fluent-bit",
+		"otel/opentelemetry-collector",
+		"kind: ValidatingWebhookConfiguration",
+		"name: webhook",
+		"kind: PodMonitor",
+		"kind: Job",
+		"-migration\n",
+		"nvidia.com/gpu",
+		"kubernetes.io/arch: arm64",
+		"vault.hashicorp.com/agent-inject: \"true\"",
+		"checksum/config",
+		"checksum/secret",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart, got:\n%s", expect, out)
+		}
+	}
+}
+
+func TestCreateUnicodeNameCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	if _, _, err := executeActionCommand("create 'Café Crème'"); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	c, err := loader.LoadDir("cafe-creme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != "cafe-creme" {
+		t.Errorf("Expected the name cafe-creme, got %q", c.Name())
+	}
+	if name := c.Metadata.Annotations[chartutil.OriginalNameAnnotation]; name != "Café Crème" {
+		t.Errorf("Expected the original name to be recorded, got %q", name)
+	}
+}
+
+func TestCreateFromReleaseCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	rel := release.Mock(&release.MockReleaseOptions{Name: "juno"})
+	rel.Manifest = `---
+# Source: legacy/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: juno-web
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.21
+`
+	store := storageFixture()
+	if err := store.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := executeActionCommandC(store, "create --from-release juno "+cname); err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+
+	c, err := loader.LoadDir(cname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Metadata.AppVersion != "1.0" {
+		t.Errorf("Expected the app version of the release, got %q", c.Metadata.AppVersion)
+	}
+	if len(c.Templates) != 1 || c.Templates[0].Name != "templates/web-deployment.yaml" {
+		t.Fatalf("Expected templates/web-deployment.yaml only, got %v", c.Templates)
+	}
+	if !strings.Contains(string(c.Templates[0].Data), "name: {{ .Release.Name }}-web\n") {
+		t.Errorf("Expected the deployment to be named after the release, got:\n%s", c.Templates[0].Data)
+	}
+
+	if _, _, err := executeActionCommandC(store, "create --from-release juno --skip ingress other"); err == nil {
+		t.Error("Expected an error for --skip with --from-release")
+	}
+}
+
+func TestCreateDuplicateResourcesCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	// A starter whose templates render the same config map.
+	starter := filepath.Join(ensure.TempDir(t), "starter")
+	configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}-config\n"
+	for name, content := range map[string]string{
+		"Chart.yaml":          "apiVersion: v2\nname: starter\nversion: 0.1.0\n",
+		"templates/a.yaml":    configMap,
+		"templates/b.yaml":    configMap,
+		"templates/NOTES.txt": "",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(starter, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(starter, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, err := executeActionCommand(fmt.Sprintf("create --starter %s %s", starter, cname))
+	if err == nil || !strings.Contains(err.Error(), `ConfigMap "test-release-config" is also rendered by templates/a.yaml`) {
+		t.Errorf("Expected an error for the duplicate config map, got %v", err)
+	}
+}
+
+func TestCreateFromReleaseDelimitersCmd(t *testing.T) {
+	defer ensure.HelmHome(t)()
+	cname := "testchart"
+	dir := ensure.TempDir(t)
+	defer testChdir(t, dir)()
+
+	rel := release.Mock(&release.MockReleaseOptions{Name: "juno"})
+	rel.Manifest = `---
+# Source: legacy/templates/rules.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: juno-rules
+data:
+  rules.yaml: |
+    summary: Instance {{ $labels.instance }} is down
+---
+# Source: legacy/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: juno-db
+data:
+  password: aHVudGVyMg==
+`
+	store := storageFixture()
+	if err := store.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+	_, out, err := executeActionCommandC(store, "create --from-release juno "+cname)
+	if err != nil {
+		t.Fatalf("Failed to run create: %s", err)
+	}
+	if !strings.Contains(out, "WARNING: The data of the Secret \"juno-db\" is not copied") {
+		t.Errorf("Expected a warning about the data of the Secret, got:\n%s", out)
+	}
+
+	// The template text of the config map is rendered as it was.
+	_, out, err = executeActionCommand("template " + cname + " --set db.data.password=secret")
+	if err != nil {
+		t.Fatalf("Failed to render chart: %s", err)
+	}
+	for _, expect := range []string{"summary: Instance {{ $labels.instance }} is down\n", "password: \"c2VjcmV0\"\n"} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("Expected %q in the rendered chart, got:\n%s", expect, out)
+		}
+	}
+	if strings.Contains(out, "aHVudGVyMg==") {
+		t.Error("Expected the password of the release to be left out")
+	}
+}
+
 func TestCreateStarterCmd(t *testing.T) {
 	defer ensure.HelmHome(t)()
 	cname := "testchart"
@@ -81,6 +1768,15 @@ func TestCreateStarterCmd(t *testing.T) {
 		t.Fatalf("Could not write template: %s", err)
 	}
 
+	// The defaults of the default scaffold are not read for a starter, so a
+	// mistake in them does not get in the way.
+	if err := os.MkdirAll(helmpath.ConfigPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(helmpath.ConfigPath(chartutil.CreateDefaultsFileName), []byte("imageRegistri: typo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
 	// Run a create
 	if _, _, err := executeActionCommand(fmt.Sprintf("create --starter=starterchart %s", cname)); err != nil {
 		t.Errorf("Failed to run create: %s", err)
@@ -124,6 +1820,9 @@ func TestCreateStarterCmd(t *testing.T) {
 		t.Error("Did not find foo.tpl")
 	}
 
+	if _, _, err := executeActionCommand("create --starter=starterchart --skip tests other"); err == nil {
+		t.Error("Expected an error combining --starter and --skip")
+	}
 }
 
 func TestCreateStarterAbsoluteCmd(t *testing.T) {
@@ -85,6 +85,8 @@ func main() {
 		switch e := err.(type) {
 		case pluginError:
 			os.Exit(e.code)
+		case exitError:
+			os.Exit(e.code)
 		default:
 			os.Exit(1)
 		}
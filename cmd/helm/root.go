@@ -162,7 +162,7 @@ func newRootCmd(actionConfig *action.Configuration, out io.Writer, args []string
 	// Add subcommands
 	cmd.AddCommand(
 		// chart commands
-		newCreateCmd(out),
+		newCreateCmd(actionConfig, out),
 		newDependencyCmd(actionConfig, out),
 		newPullCmd(actionConfig, out),
 		newShowCmd(actionConfig, out),
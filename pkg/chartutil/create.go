@@ -17,17 +17,26 @@ limitations under the License.
 package chartutil
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
 
+	"helm.sh/helm/v3/internal/ignore"
+	"helm.sh/helm/v3/internal/sympath"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 )
@@ -43,12 +52,17 @@ const (
 	ChartfileName = "Chart.yaml"
 	// ValuesfileName is the default values file name.
 	ValuesfileName = "values.yaml"
+	// EnvironmentValuesfileName is the format of the name of the values file
+	// for an environment.
+	EnvironmentValuesfileName = "values-%s.yaml"
 	// SchemafileName is the default values schema file name.
 	SchemafileName = "values.schema.json"
 	// TemplatesDir is the relative directory name for templates.
 	TemplatesDir = "templates"
 	// ChartsDir is the relative directory name for charts dependencies.
 	ChartsDir = "charts"
+	// CRDsDir is the relative directory name for custom resource definitions.
+	CRDsDir = "crds"
 	// TemplatesTestsDir is the relative directory name for tests.
 	TemplatesTestsDir = TemplatesDir + sep + "tests"
 	// IgnorefileName is the name of the Helm ignore file.
@@ -67,10 +81,93 @@ const (
 	NotesName = TemplatesDir + sep + "NOTES.txt"
 	// HelpersName is the name of the example helpers file.
 	HelpersName = TemplatesDir + sep + "_helpers.tpl"
+	// PullSecretName is the name of the example image pull secret file.
+	PullSecretName = TemplatesDir + sep + "pullsecret.yaml"
+	// PodMonitorName is the name of the example pod monitor file.
+	PodMonitorName = TemplatesDir + sep + "podmonitor.yaml"
+	// RBACName is the name of the example operator RBAC file.
+	RBACName = TemplatesDir + sep + "rbac.yaml"
+	// WebhookName is the name of the example admission webhook file.
+	WebhookName = TemplatesDir + sep + "webhook.yaml"
+	// CRDsReadmeName is the name of the file explaining the crds directory.
+	CRDsReadmeName = CRDsDir + sep + "README.md"
+	// HookJobName is the name of the example hook Job file.
+	HookJobName = TemplatesDir + sep + "hookjob.yaml"
+	// MigrationJobName is the name of the example migration Job file.
+	MigrationJobName = TemplatesDir + sep + "migration-job.yaml"
+	// CanaryIngressName is the name of the canary ingress file.
+	CanaryIngressName = TemplatesDir + sep + "ingress-canary.yaml"
+	// StatefulSetName is the name of the StatefulSet file, which replaces the
+	// deployment file with the stateful preset.
+	StatefulSetName = TemplatesDir + sep + "statefulset.yaml"
+	// HeadlessServiceName is the name of the headless service file of the
+	// StatefulSet.
+	HeadlessServiceName = TemplatesDir + sep + "service-headless.yaml"
+	// ScaledObjectName is the name of the KEDA ScaledObject file of the
+	// consumer preset.
+	ScaledObjectName = TemplatesDir + sep + "scaledobject.yaml"
+	// CronJobName is the name of the example CronJob file.
+	CronJobName = TemplatesDir + sep + "cronjob.yaml"
+	// CronConfigMapName is the name of the example CronJob configuration
+	// file.
+	CronConfigMapName = TemplatesDir + sep + "cron-configmap.yaml"
+	// OtelConfigMapName is the name of the example OpenTelemetry Collector
+	// configuration file.
+	OtelConfigMapName = TemplatesDir + sep + "otel-configmap.yaml"
+	// LogConfigMapName is the name of the example fluent-bit configuration
+	// file.
+	LogConfigMapName = TemplatesDir + sep + "fluent-bit-configmap.yaml"
+	// PersistentVolumeClaimName is the name of the example persistent volume
+	// claim file.
+	PersistentVolumeClaimName = TemplatesDir + sep + "pvc.yaml"
+	// SecretName is the name of the example secret file.
+	SecretName = TemplatesDir + sep + "secret.yaml"
+	// SecretsValuesfileName is the name of the values file holding the
+	// sensitive values, which is meant to be kept encrypted.
+	SecretsValuesfileName = "secrets.yaml"
+	// CredentialsValuesfileName is the name of the values file holding the
+	// registry credentials of the image pull secret.
+	CredentialsValuesfileName = "credentials.yaml"
 	// TestConnectionName is the name of the example test file.
 	TestConnectionName = TemplatesTestsDir + sep + "test-connection.yaml"
 )
 
+// The resources of the default scaffold that can be chosen with
+// CreateOptions.Skip and CreateOptions.Only.
+const (
+	// ScaffoldDeployment is the deployment and its NOTES.txt.
+	ScaffoldDeployment = "deployment"
+	// ScaffoldService is the service exposing the deployment.
+	ScaffoldService = "service"
+	// ScaffoldServiceAccount is the service account the deployment runs as.
+	ScaffoldServiceAccount = "serviceaccount"
+	// ScaffoldIngress is the ingress routing to the service.
+	ScaffoldIngress = "ingress"
+	// ScaffoldHorizontalPodAutoscaler is the hpa scaling the deployment.
+	ScaffoldHorizontalPodAutoscaler = "hpa"
+	// ScaffoldTests is the connection test run by 'helm test'.
+	ScaffoldTests = "tests"
+)
+
+// scaffoldRequires maps a scaffold resource to the resources its templates
+// refer to.
+var scaffoldRequires = map[string][]string{
+	ScaffoldService:                 {ScaffoldDeployment},
+	ScaffoldIngress:                 {ScaffoldService},
+	ScaffoldHorizontalPodAutoscaler: {ScaffoldDeployment},
+	ScaffoldTests:                   {ScaffoldService},
+}
+
+// ScaffoldResources lists every resource of the default scaffold.
+var ScaffoldResources = []string{
+	ScaffoldDeployment,
+	ScaffoldService,
+	ScaffoldServiceAccount,
+	ScaffoldIngress,
+	ScaffoldHorizontalPodAutoscaler,
+	ScaffoldTests,
+}
+
 // maxChartNameLength is lower than the limits we know of with certain file systems,
 // and with certain Kubernetes fields.
 const maxChartNameLength = 250
@@ -103,23 +200,53 @@ version: 0.1.0
 appVersion: "1.16.0"
 `
 
-const defaultValues = `# Default values for %s.
+// defaultValues holds the default values.yaml in sections. Each section is
+// only written when the scaffold resource that reads it is generated; sections
+// without a resource are always written.
+var defaultValues = []struct {
+	resource string
+	content  string
+}{
+	{"", `# Default values for <CHARTNAME>.
 # This is a YAML-formatted file.
 # Declare variables to be passed into your templates.
 
-replicaCount: 1
+`},
+	{ScaffoldDeployment, `replicaCount: 1
+
+# How the deployment replaces old pods with new ones. rollingUpdate only
+# applies to the RollingUpdate type; the alternative is Recreate.
+strategy:
+  type: RollingUpdate
+  rollingUpdate:
+    maxSurge: 25%
+    maxUnavailable: 25%
+
+# The number of old ReplicaSets kept to allow a rollback.
+revisionHistoryLimit: 3
+
+# Seconds a rollout may make no progress before it is reported as failed.
+progressDeadlineSeconds: 600
 
 image:
   repository: nginx
   pullPolicy: IfNotPresent
   # Overrides the image tag whose default is the chart appVersion.
   tag: ""
+  # Pins the image to a digest, such as "sha256:...", which takes precedence over the tag.
+  digest: ""
 
 imagePullSecrets: []
-nameOverride: ""
+`},
+	{"", `nameOverride: ""
 fullnameOverride: ""
 
-serviceAccount:
+# Labels and annotations added to the metadata of every resource.
+commonLabels: {}
+commonAnnotations: {}
+
+`},
+	{ScaffoldServiceAccount, `serviceAccount:
   # Specifies whether a service account should be created
   create: true
   # Annotations to add to the service account
@@ -128,7 +255,14 @@ serviceAccount:
   # If not set and create is true, a name is generated using the fullname template
   name: ""
 
-podAnnotations: {}
+`},
+	{ScaffoldDeployment, `podAnnotations: {}
+
+# Sidecar injection of a service mesh into the pods, overriding the setting of
+# the namespace. Set provider to istio or linkerd.
+mesh:
+  provider: ""
+  inject: true
 
 podSecurityContext: {}
   # fsGroup: 2000
@@ -141,11 +275,20 @@ securityContext: {}
   # runAsNonRoot: true
   # runAsUser: 1000
 
-service:
+`},
+	{ScaffoldService, `service:
   type: ClusterIP
   port: 80
+  # The protocol of the port and of the container port: TCP, UDP or SCTP. The
+  # HTTP probes of the deployment need to be replaced for UDP and SCTP.
+  protocol: TCP
+  # The application protocol of the port, such as http, h2c or
+  # kubernetes.io/h2c for gRPC, telling proxies and service meshes how to
+  # handle its traffic.
+  appProtocol: ""
 
-ingress:
+`},
+	{ScaffoldIngress, `ingress:
   enabled: false
   className: ""
   annotations: {}
@@ -161,7 +304,8 @@ ingress:
   #    hosts:
   #      - chart-example.local
 
-resources: {}
+`},
+	{ScaffoldDeployment, `resources: {}
   # We usually recommend not to specify default resources and to leave this as a conscious
   # choice for the user. This also increases chances charts run on environments with little
   # resources, such as Minikube. If you do want to specify resources, uncomment the following
@@ -173,19 +317,22 @@ resources: {}
   #   cpu: 100m
   #   memory: 128Mi
 
-autoscaling:
+`},
+	{ScaffoldHorizontalPodAutoscaler, `autoscaling:
   enabled: false
   minReplicas: 1
   maxReplicas: 100
   targetCPUUtilizationPercentage: 80
   # targetMemoryUtilizationPercentage: 80
 
-nodeSelector: {}
+`},
+	{ScaffoldDeployment, `nodeSelector: {}
 
 tolerations: []
 
 affinity: {}
-`
+`},
+}
 
 const defaultIgnore = `# Patterns to ignore when building packages.
 # This supports shell glob matching, relative path matching, and
@@ -282,37 +429,56 @@ metadata:
   labels:
     {{- include "<CHARTNAME>.labels" . | nindent 4 }}
 spec:
-  {{- if not .Values.autoscaling.enabled }}
-  replicas: {{ .Values.replicaCount }}
-  {{- end }}
+%[1]s  revisionHistoryLimit: {{ .Values.revisionHistoryLimit }}
+  progressDeadlineSeconds: {{ .Values.progressDeadlineSeconds }}
+  strategy:
+    type: {{ .Values.strategy.type }}
+    {{- if eq .Values.strategy.type "RollingUpdate" }}
+    {{- with .Values.strategy.rollingUpdate }}
+    rollingUpdate:
+      {{- toYaml . | nindent 6 }}
+    {{- end }}
+    {{- end }}
   selector:
     matchLabels:
       {{- include "<CHARTNAME>.selectorLabels" . | nindent 6 }}
   template:
     metadata:
-      {{- with .Values.podAnnotations }}
+      {{- $meshAnnotations := include "<CHARTNAME>.meshAnnotations" . }}
+      {{- if or .Values.podAnnotations $meshAnnotations }}
       annotations:
+        {{- with .Values.podAnnotations }}
         {{- toYaml . | nindent 8 }}
+        {{- end }}
+        {{- with $meshAnnotations }}
+        {{- . | nindent 8 }}
+        {{- end }}
       {{- end }}
       labels:
         {{- include "<CHARTNAME>.selectorLabels" . | nindent 8 }}
+        {{- with include "<CHARTNAME>.meshLabels" . }}
+        {{- . | nindent 8 }}
+        {{- end }}
     spec:
       {{- with .Values.imagePullSecrets }}
       imagePullSecrets:
         {{- toYaml . | nindent 8 }}
       {{- end }}
-      serviceAccountName: {{ include "<CHARTNAME>.serviceAccountName" . }}
-      securityContext:
+%[2]s      securityContext:
         {{- toYaml .Values.podSecurityContext | nindent 8 }}
       containers:
         - name: {{ .Chart.Name }}
           securityContext:
             {{- toYaml .Values.securityContext | nindent 12 }}
+          {{- if .Values.image.digest }}
+          image: "{{ .Values.image.repository }}@{{ .Values.image.digest }}"
+          {{- else }}
           image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"
+          {{- end }}
           imagePullPolicy: {{ .Values.image.pullPolicy }}
-          ports:
+%[4]s          ports:
             - name: http
-              containerPort: 80
+              containerPort: %[3]d
               protocol: TCP
           livenessProbe:
             httpGet:
@@ -338,6 +504,676 @@ spec:
       {{- end }}
 `
 
+// The probes of the container that can be chosen with CreateOptions.Probe.
+const (
+	// ProbeHTTP probes the container with an HTTP GET of /.
+	ProbeHTTP = "http"
+	// ProbeGRPC probes the container with the gRPC health checking protocol,
+	// which needs Kubernetes 1.24. Older clusters get a TCP probe instead.
+	ProbeGRPC = "grpc"
+	// ProbeTCP probes the container by opening a TCP connection to it.
+	ProbeTCP = "tcp"
+	// ProbeExec probes the container by running a command in it.
+	ProbeExec = "exec"
+)
+
+// Probes lists the probes of the container.
+var Probes = []string{ProbeHTTP, ProbeGRPC, ProbeTCP, ProbeExec}
+
+// containerHTTPProbes are the probes of defaultDeployment, and probeHandlers
+// the handlers that replace their httpGet for each of the other Probes.
+const containerHTTPProbes = `          livenessProbe:
+            httpGet:
+              path: /
+              port: http
+          readinessProbe:
+            httpGet:
+              path: /
+              port: http
+`
+
+var probeHandlers = map[string]string{
+	ProbeGRPC: `            {{- if semverCompare ">=1.24-0" .Capabilities.KubeVersion.GitVersion }}
+            grpc:
+              port: %[3]d
+            {{- else }}
+            tcpSocket:
+              port: http
+            {{- end }}
+`,
+	ProbeTCP: `            tcpSocket:
+              port: http
+`,
+	ProbeExec: `            exec:
+              # Replace with a command that fails when the application is unhealthy.
+              command:
+                - /bin/true
+`,
+}
+
+// Fragments of defaultDeployment that depend on optional scaffold resources.
+const (
+	containerProtocol = `              containerPort: %[3]d
+              protocol: TCP
+`
+	containerServiceProtocol = `              containerPort: %[3]d
+              protocol: {{ .Values.service.protocol }}
+`
+	deploymentAutoscaledReplicas = `  {{- if not .Values.autoscaling.enabled }}
+  replicas: {{ .Values.replicaCount }}
+  {{- end }}
+`
+	deploymentReplicas = `  replicas: {{ .Values.replicaCount }}
+`
+	deploymentServiceAccountName = `      serviceAccountName: {{ include "<CHARTNAME>.serviceAccountName" . }}
+`
+	deploymentSecretEnv = `          {{- if .Values.secrets }}
+          envFrom:
+` + deploymentSecretEnvFrom + `          {{- end }}
+`
+	deploymentSecretEnvFrom = `            - secretRef:
+                name: {{ include "<CHARTNAME>.fullname" . }}
+`
+)
+
+// deploymentPodAnnotations is the annotations block of the pods of
+// defaultDeployment, and deploymentChecksumPodAnnotations the one that starts
+// with the checksums of the generated configuration, so that changing it rolls
+// the pods.
+const (
+	deploymentPodAnnotations = `      {{- if or .Values.podAnnotations $meshAnnotations }}
+      annotations:
+        {{- with .Values.podAnnotations }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+        {{- with $meshAnnotations }}
+        {{- . | nindent 8 }}
+        {{- end }}
+      {{- end }}
+`
+	deploymentChecksumPodAnnotations = `      annotations:
+%s        {{- with .Values.podAnnotations }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+        {{- with $meshAnnotations }}
+        {{- . | nindent 8 }}
+        {{- end }}
+`
+)
+
+// checksumAnnotation renders a pod annotation holding the sha256 sum of the
+// given templates as rendered together.
+func checksumAnnotation(key string, templates []string) string {
+	includes := make([]string, len(templates))
+	for i, t := range templates {
+		// Template names always use forward slashes.
+		includes[i] = fmt.Sprintf("include (print $.Template.BasePath %q) .", "/"+filepath.Base(t))
+	}
+	expr := includes[0]
+	if len(includes) > 1 {
+		expr = "print (" + strings.Join(includes, ") (") + ")"
+	}
+	return fmt.Sprintf("        %s: {{ %s | sha256sum }}\n", key, expr)
+}
+
+// Fragments of defaultDeployment that run an OpenTelemetry Collector sidecar.
+const (
+	containerPorts = `          ports:
+            - name: http
+`
+	containerResources = `          resources:
+            {{- toYaml .Values.resources | nindent 12 }}
+`
+	deploymentOtelEnv = `          {{- if .Values.otel.enabled }}
+          env:
+` + deploymentOtelEnvVar + `          {{- end }}
+`
+	deploymentOtelEnvVar = `            - name: OTEL_EXPORTER_OTLP_ENDPOINT
+              value: http://localhost:4318
+`
+	deploymentOtelSidecar = `        {{- if .Values.otel.enabled }}
+        - name: otel-collector
+          image: "{{ .Values.otel.image.repository }}:{{ .Values.otel.image.tag }}"
+          imagePullPolicy: {{ .Values.otel.image.pullPolicy }}
+          args:
+            - --config=/conf/config.yaml
+          ports:
+            - name: otlp-grpc
+              containerPort: 4317
+              protocol: TCP
+            - name: otlp-http
+              containerPort: 4318
+              protocol: TCP
+          resources:
+            {{- toYaml .Values.otel.resources | nindent 12 }}
+          volumeMounts:
+            - name: otel-config
+              mountPath: /conf
+        {{- end }}
+`
+	otelVolume = `        - name: otel-config
+          configMap:
+            name: {{ include "<CHARTNAME>.fullname" . }}-otel
+`
+)
+
+// Fragments of defaultDeployment that run a fluent-bit sidecar shipping the
+// log files of the application.
+const (
+	logMount = `            - name: app-logs
+              mountPath: {{ .Values.logSidecar.path }}
+`
+	deploymentLogSidecar = `        {{- if .Values.logSidecar.enabled }}
+        - name: fluent-bit
+          image: "{{ .Values.logSidecar.image.repository }}:{{ .Values.logSidecar.image.tag }}"
+          imagePullPolicy: {{ .Values.logSidecar.image.pullPolicy }}
+          resources:
+            {{- toYaml .Values.logSidecar.resources | nindent 12 }}
+          volumeMounts:
+            - name: app-logs
+              mountPath: {{ .Values.logSidecar.path }}
+              readOnly: true
+            - name: fluent-bit-config
+              mountPath: /fluent-bit/etc/
+        {{- end }}
+`
+	logVolumes = `        - name: app-logs
+          emptyDir: {}
+        - name: fluent-bit-config
+          configMap:
+            name: {{ include "<CHARTNAME>.fullname" . }}-fluent-bit
+`
+)
+
+const defaultLogConfigMap = `{{- if .Values.logSidecar.enabled }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "<CHARTNAME>.fullname" . }}-fluent-bit
+  labels:
+    {{- include "<CHARTNAME>.labels" . | nindent 4 }}
+data:
+  fluent-bit.conf: |
+    [SERVICE]
+        Flush        5
+        Parsers_File parsers.conf
+
+    [INPUT]
+        Name   tail
+        Path   {{ .Values.logSidecar.path }}/*.log
+        Parser {{ .Values.logSidecar.parser }}
+
+    [OUTPUT]
+        {{- range $key, $value := .Values.logSidecar.output }}
+        {{ $key }} {{ $value }}
+        {{- end }}
+  parsers.conf: |
+    [PARSER]
+        Name        json
+        Format      json
+        Time_Key    time
+        Time_Format %Y-%m-%dT%H:%M:%S.%L%z
+{{- end }}
+`
+
+const defaultLogValues = `# A fluent-bit sidecar that ships the log files the application writes to
+# logSidecar.path, a volume shared with the sidecar.
+logSidecar:
+  enabled: false
+  image:
+    repository: fluent/fluent-bit
+    pullPolicy: IfNotPresent
+    tag: "2.2.0"
+  path: /var/log/app
+  # The parser of each log line, from parsers.conf.
+  parser: json
+  # The fluent-bit [OUTPUT] section, as key/value pairs.
+  output:
+    Name: stdout
+    Match: "*"
+  resources: {}
+`
+
+// podVolume is a volume, or a volume mount, of defaultDeployment, rendered
+// when condition holds.
+type podVolume struct {
+	condition string
+	content   string
+}
+
+// podVolumes renders the volumes block of the pods from the volumes needed by
+// the sidecars and the persistent volume.
+func podVolumes(volumes []podVolume) string {
+	return conditionalList("      ", "volumes", volumes)
+}
+
+// containerVolumeMounts renders the volumeMounts block of the application
+// container from the volumes it shares.
+func containerVolumeMounts(mounts []podVolume) string {
+	return conditionalList("          ", "volumeMounts", mounts)
+}
+
+// conditionalList renders key at indent as a list of the items whose
+// condition holds, leaving it out when none does.
+func conditionalList(indent, key string, items []podVolume) string {
+	if len(items) == 0 {
+		return ""
+	}
+	conditions := make([]string, len(items))
+	for i, v := range items {
+		conditions[i] = v.condition
+	}
+	condition := conditions[0]
+	if len(conditions) > 1 {
+		condition = "or " + strings.Join(conditions, " ")
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%[1]s{{- if %[2]s }}\n%[1]s%[3]s:\n", indent, condition, key)
+	for _, v := range items {
+		fmt.Fprintf(&sb, "%[1]s  {{- if %[2]s }}\n%[3]s%[1]s  {{- end }}\n", indent, v.condition, v.content)
+	}
+	fmt.Fprintf(&sb, "%s{{- end }}\n", indent)
+	return sb.String()
+}
+
+// Fragments of defaultDeployment and defaultService that serve TLS in the pod
+// with the certificate of a Secret.
+const (
+	tlsContainerPort = `            {{- if .Values.tls.enabled }}
+            - name: https
+              containerPort: {{ .Values.tls.port }}
+              protocol: TCP
+            {{- end }}
+`
+	httpProbePort = `              path: /
+              port: http
+`
+	tlsProbePort = `              path: /
+              {{- if .Values.tls.enabled }}
+              port: https
+              scheme: HTTPS
+              {{- else }}
+              port: http
+              {{- end }}
+`
+	tlsMount = `            - name: tls
+              mountPath: {{ .Values.tls.mountPath }}
+              readOnly: true
+`
+	tlsVolume = `        - name: tls
+          secret:
+            secretName: {{ required "tls.secretName is required when tls.enabled is set" .Values.tls.secretName }}
+`
+	serviceTargetPort = `      targetPort: http
+`
+	tlsServiceTargetPort = `      targetPort: {{ ternary "https" "http" .Values.tls.enabled }}
+`
+)
+
+const defaultTLSValues = `# Serving TLS in the pod on tls.port, with the certificate and key of
+# tls.secretName, a kubernetes.io/tls Secret mounted at tls.mountPath. The
+# service and the HTTP probes then use this port.
+tls:
+  enabled: false
+  secretName: ""
+  mountPath: /etc/tls
+  port: 8443
+`
+
+// Fragments of defaultDeployment that mount the persistent volume into the
+// application container.
+const (
+	persistenceMount = `            - name: data
+              mountPath: {{ .Values.persistence.mountPath }}
+`
+	persistenceVolume = `        - name: data
+          persistentVolumeClaim:
+            claimName: {{ .Values.persistence.existingClaim | default (include "<CHARTNAME>.fullname" .) }}
+`
+)
+
+const defaultPersistentVolumeClaim = `{{- if and .Values.persistence.enabled (not .Values.persistence.existingClaim) }}
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: {{ include "<CHARTNAME>.fullname" . }}
+  labels:
+    {{- include "<CHARTNAME>.labels" . | nindent 4 }}
+  {{- with .Values.persistence.annotations }}
+  annotations:
+    {{- toYaml . | nindent 4 }}
+  {{- end }}
+spec:
+  accessModes:
+    {{- toYaml .Values.persistence.accessModes | nindent 4 }}
+  {{- with .Values.persistence.storageClass }}
+  storageClassName: {{ if eq . "-" }}""{{ else }}{{ . }}{{ end }}
+  {{- end }}
+  resources:
+    requests:
+      storage: {{ .Values.persistence.size | quote }}
+{{- end }}
+`
+
+const defaultPersistenceValues = `# A persistent volume mounted into the application at persistence.mountPath.
+# With a ReadWriteOnce volume, set strategy.type to Recreate so that the new
+# pod does not wait for the old one to release it.
+persistence:
+  enabled: false
+  # The name of an existing PersistentVolumeClaim to use instead of creating one.
+  existingClaim: ""
+  # The storage class of the claim. If empty, the default storage class of the
+  # cluster is used; if "-", dynamic provisioning is disabled.
+  storageClass: ""
+  accessModes:
+    - ReadWriteOnce
+  size: 8Gi
+  annotations: {}
+  mountPath: /data
+`
+
+const defaultOtelConfigMap = `{{- if .Values.otel.enabled }}
+{{- $exporter := ternary "otlp" "debug" (ne .Values.otel.exporter.endpoint "") }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "<CHARTNAME>.fullname" . }}-otel
+  labels:
+    {{- include "<CHARTNAME>.labels" . | nindent 4 }}
+data:
+  config.yaml: |
+    receivers:
+      otlp:
+        protocols:
+          grpc: {}
+          http: {}
+    processors:
+      batch: {}
+    exporters:
+      {{- if eq $exporter "otlp" }}
+      otlp:
+        endpoint: {{ .Values.otel.exporter.endpoint }}
+      {{- else }}
+      debug: {}
+      {{- end }}
+    service:
+      pipelines:
+        {{- range list "traces" "metrics" "logs" }}
+        {{ . }}:
+          receivers: [otlp]
+          processors: [batch]
+          exporters: [{{ $exporter }}]
+        {{- end }}
+{{- end }}
+`
+
+const defaultOtelValues = `# An OpenTelemetry Collector sidecar that receives OTLP from the application on
+# localhost and exports it to otel.exporter.endpoint, or logs it while that is
+# empty.
+otel:
+  enabled: false
+  image:
+    repository: otel/opentelemetry-collector
+    pullPolicy: IfNotPresent
+    tag: "0.88.0"
+  exporter:
+    endpoint: ""
+  resources: {}
+`
+
+// SecretsProviderSops keeps the sensitive values in a secrets.yaml meant to
+// be encrypted with sops and used through the helm-secrets plugin.
+const SecretsProviderSops = "sops"
+
+const defaultSecret = `{{- if .Values.secrets }}
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ include "<CHARTNAME>.fullname" . }}
+  labels:
+    {{- include "<CHARTNAME>.labels" . | nindent 4 }}
+type: Opaque
+data:
+  {{- range $key, $value := .Values.secrets }}
+  {{ $key }}: {{ $value | toString | b64enc | quote }}
+  {{- end }}
+{{- end }}
+`
+
+const defaultSopsSecretsValues = `# Sensitive values for <CHARTNAME>. Encrypt this file with sops before
+# committing it:
+#   sops --encrypt --in-place secrets.yaml
+# sops picks the keys to encrypt with from a creation rule in .sops.yaml, e.g.:
+#   creation_rules:
+#     - path_regex: secrets\.yaml$
+#       pgp: <FINGERPRINT>
+# Install with the helm-secrets plugin, which decrypts it on the fly:
+#   helm secrets install <CHARTNAME> . -f secrets.yaml
+#
+# Every key becomes an environment variable of the container.
+secrets:
+  EXAMPLE_PASSWORD: changeme
+`
+
+// Architectures are the values of the kubernetes.io/arch node label that
+// CreateOptions.Arch accepts.
+var Architectures = []string{"amd64", "arm64", "arm", "ppc64le", "s390x"}
+
+func isArch(arch string) bool {
+	for _, a := range Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// GPU vendors whose devices CreateOptions.GPU requests.
+const (
+	GPUNvidia = "nvidia"
+)
+
+// gpuResources are the extended resources requested for one GPU of a vendor.
+var gpuResources = map[string]string{
+	GPUNvidia: "nvidia.com/gpu",
+}
+
+// gpuRuntimeClasses are the values of runtimeClassName for the container
+// runtime of a GPU vendor.
+var gpuRuntimeClasses = map[string]string{
+	GPUNvidia: `# The runtime class of the NVIDIA container toolkit, which exposes the GPUs
+# to the container.
+runtimeClassName: nvidia
+`,
+}
+
+// podRuntimeClassName sets the runtime class of the pods from values.
+const podRuntimeClassName = `      {{- with .Values.runtimeClassName }}
+      runtimeClassName: {{ . }}
+      {{- end }}
+`
+
+// podSecurityContext is the pod security context of defaultDeployment.
+const podSecurityContext = `      securityContext:
+        {{- toYaml .Values.podSecurityContext | nindent 8 }}
+`
+
+// spotNodeLabel returns the key and value of the spot node label in d.
+func spotNodeLabel(d CreateDefaults) (string, string, error) {
+	label := d.SpotNodeLabel
+	if label == "" {
+		label = DefaultSpotNodeLabel
+	}
+	kv := strings.SplitN(label, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return "", "", errors.Errorf("spot node label %q must be of the form key=value", label)
+	}
+	return kv[0], kv[1], nil
+}
+
+// spotAffinity prefers, without requiring, the nodes of spot node pools so
+// that the pods still schedule when none are available.
+const spotAffinity = `# Prefer spot or preemptible nodes, falling back to other nodes when none are
+# available.
+affinity:
+  nodeAffinity:
+    preferredDuringSchedulingIgnoredDuringExecution:
+      - weight: 100
+        preference:
+          matchExpressions:
+            - key: %s
+              operator: In
+              values:
+                - %q
+`
+
+// schedulingValues renders the nodeSelector, tolerations and affinity of the
+// default values for CreateOptions.Arch, CreateOptions.GPU and
+// CreateOptions.Spot.
+func schedulingValues(opts CreateOptions) (string, error) {
+	var spotKey, spotValue string
+	if opts.Spot {
+		var err error
+		if spotKey, spotValue, err = spotNodeLabel(opts.Defaults); err != nil {
+			return "", err
+		}
+	}
+	var sb strings.Builder
+	if opts.GPU != "" {
+		sb.WriteString(gpuRuntimeClasses[opts.GPU] + "\n")
+	}
+	if opts.Arch != "" {
+		fmt.Fprintf(&sb, "nodeSelector:\n  kubernetes.io/arch: %s\n\n", opts.Arch)
+	} else {
+		sb.WriteString("nodeSelector: {}\n\n")
+	}
+	if opts.Arch != "" {
+		sb.WriteString("# Nodes of one architecture in a mixed-architecture cluster are often tainted\n")
+		sb.WriteString("# so that only workloads built for it are scheduled there.\n")
+	}
+	if opts.GPU != "" {
+		sb.WriteString("# GPU nodes are usually tainted to keep other workloads off them.\n")
+	}
+	if opts.Spot {
+		sb.WriteString("# Spot or preemptible nodes are usually tainted so that only workloads that\n")
+		sb.WriteString("# tolerate being evicted at short notice are scheduled there.\n")
+	}
+	if opts.Arch == "" && opts.GPU == "" && !opts.Spot {
+		sb.WriteString("tolerations: []\n")
+	} else {
+		sb.WriteString("tolerations:\n")
+	}
+	if opts.Arch != "" {
+		fmt.Fprintf(&sb, "  - key: kubernetes.io/arch\n    operator: Equal\n    value: %s\n    effect: NoSchedule\n", opts.Arch)
+	}
+	if opts.GPU != "" {
+		fmt.Fprintf(&sb, "  - key: %s\n    operator: Exists\n    effect: NoSchedule\n", gpuResources[opts.GPU])
+	}
+	if opts.Spot {
+		fmt.Fprintf(&sb, "  - key: %s\n    operator: Equal\n    value: %q\n    effect: NoSchedule\n", spotKey, spotValue)
+		fmt.Fprintf(&sb, "\n"+spotAffinity, spotKey, spotValue)
+	} else {
+		sb.WriteString("\naffinity: {}\n")
+	}
+	return sb.String(), nil
+}
+
+// withGPULimit returns a copy of resources with a limit of one GPU.
+func withGPULimit(resources map[string]interface{}, gpu string) map[string]interface{} {
+	r := make(map[string]interface{}, len(resources)+1)
+	for k, v := range resources {
+		r[k] = v
+	}
+	limits := map[string]interface{}{}
+	if l, ok := r["limits"].(map[string]interface{}); ok {
+		for k, v := range l {
+			limits[k] = v
+		}
+	}
+	limits[gpuResources[gpu]] = 1
+	r["limits"] = limits
+	return r
+}
+
+// Cloud providers whose workload identity CreateOptions.WorkloadIdentity sets
+// up.
+const (
+	WorkloadIdentityGKE = "gke"
+	WorkloadIdentityEKS = "eks"
+	WorkloadIdentityAKS = "aks"
+)
+
+// workloadIdentityAnnotations are the commented service account annotations
+// for each workload identity provider.
+var workloadIdentityAnnotations = map[string]string{
+	WorkloadIdentityGKE: `    # Impersonate a Google service account with GKE Workload Identity:
+    # iam.gke.io/gcp-service-account: <CHARTNAME>@PROJECT_ID.iam.gserviceaccount.com
+`,
+	WorkloadIdentityEKS: `    # Assume an IAM role with EKS IAM roles for service accounts:
+    # eks.amazonaws.com/role-arn: arn:aws:iam::ACCOUNT_ID:role/<CHARTNAME>
+`,
+	WorkloadIdentityAKS: `    # Federate with a managed identity with Azure AD Workload Identity. The
+    # pods get the azure.workload.identity/use label once this is set:
+    # azure.workload.identity/client-id: CLIENT_ID
+`,
+}
+
+// serviceAccountAnnotations is the service account annotations value that
+// the workload identity comments are added to.
+const serviceAccountAnnotations = `  # Annotations to add to the service account
+  annotations: {}
+`
+
+// podAzureWorkloadIdentity opts the pods into Azure AD Workload Identity once
+// its client id is set on the service account.
+const podAzureWorkloadIdentity = `        {{- if index .Values.serviceAccount.annotations "azure.workload.identity/client-id" }}
+        azure.workload.identity/use: "true"
+        {{- end }}
+`
+
+const defaultVaultValues = `# Injection of the Vault agent into the pods, which needs the Vault agent
+# injector in the cluster, see
+# https://www.vaultproject.io/docs/platform/k8s/injector/annotations
+vault:
+  enabled: false
+  # The Vault Kubernetes auth role the pod's service account logs in with.
+  role: "<CHARTNAME>"
+  # The secrets rendered to /vault/secrets/<name>, by their Vault path. Add
+  # one per file the application needs.
+  secrets:
+    config: secret/data/<CHARTNAME>/config
+`
+
+const defaultVaultHelper = `{{/*
+Pod annotations of the Vault agent injector
+*/}}
+{{- define "<CHARTNAME>.vaultAnnotations" -}}
+vault.hashicorp.com/agent-inject: "true"
+vault.hashicorp.com/role: {{ .Values.vault.role | quote }}
+{{- range $name, $path := .Values.vault.secrets }}
+vault.hashicorp.com/agent-inject-secret-{{ $name }}: {{ $path | quote }}
+{{- end }}
+{{- end }}
+`
+
+// Fragments of defaultDeployment that add the annotations of the Vault agent
+// injector to the pods. They join the annotations of the service mesh, which
+// are rendered the same way.
+const (
+	deploymentMeshAnnotations = `      {{- $meshAnnotations := include "<CHARTNAME>.meshAnnotations" . }}
+`
+	deploymentVaultAnnotations = `      {{- if .Values.vault.enabled }}
+      {{- $meshAnnotations = print $meshAnnotations "\n" (include "<CHARTNAME>.vaultAnnotations" .) | trim }}
+      {{- end }}
+`
+)
+
+// secretsValuesComment replaces the secrets values placeholder when the
+// sensitive values live in their own file.
+const secretsValuesComment = `# Sensitive values are kept in secrets.yaml.
+secrets: {}
+`
+
 const defaultService = `apiVersion: v1
 kind: Service
 metadata:
@@ -349,7 +1185,10 @@ spec:
   ports:
     - port: {{ .Values.service.port }}
       targetPort: http
-      protocol: TCP
+      protocol: {{ .Values.service.protocol }}
+      {{- with .Values.service.appProtocol }}
+      appProtocol: {{ . }}
+      {{- end }}
       name: http
   selector:
     {{- include "<CHARTNAME>.selectorLabels" . | nindent 4 }}
@@ -400,28 +1239,54 @@ spec:
 `
 
 const defaultNotes = `1. Get the application URL by running these commands:
-{{- if .Values.ingress.enabled }}
-{{- range $host := .Values.ingress.hosts }}
+`
+
+// defaultNotesBranches are the ways NOTES.txt explains how to reach the
+// application, in order of preference. A branch is only written when its
+// resource is generated. The last branch is the port-forward fallback, which
+// is written unconditionally when there is no service to choose by.
+var defaultNotesBranches = []struct {
+	resource  string
+	condition string
+	content   string
+}{
+	{
+		resource:  ScaffoldIngress,
+		condition: `.Values.ingress.enabled`,
+		content: `{{- range $host := .Values.ingress.hosts }}
   {{- range .paths }}
   http{{ if $.Values.ingress.tls }}s{{ end }}://{{ $host.host }}{{ .path }}
   {{- end }}
 {{- end }}
-{{- else if contains "NodePort" .Values.service.type }}
-  export NODE_PORT=$(kubectl get --namespace {{ .Release.Namespace }} -o jsonpath="{.spec.ports[0].nodePort}" services {{ include "<CHARTNAME>.fullname" . }})
+`,
+	},
+	{
+		resource:  ScaffoldService,
+		condition: `contains "NodePort" .Values.service.type`,
+		content: `  export NODE_PORT=$(kubectl get --namespace {{ .Release.Namespace }} -o jsonpath="{.spec.ports[0].nodePort}" services {{ include "<CHARTNAME>.fullname" . }})
   export NODE_IP=$(kubectl get nodes --namespace {{ .Release.Namespace }} -o jsonpath="{.items[0].status.addresses[0].address}")
   echo http://$NODE_IP:$NODE_PORT
-{{- else if contains "LoadBalancer" .Values.service.type }}
-     NOTE: It may take a few minutes for the LoadBalancer IP to be available.
+`,
+	},
+	{
+		resource:  ScaffoldService,
+		condition: `contains "LoadBalancer" .Values.service.type`,
+		content: `     NOTE: It may take a few minutes for the LoadBalancer IP to be available.
            You can watch the status of by running 'kubectl get --namespace {{ .Release.Namespace }} svc -w {{ include "<CHARTNAME>.fullname" . }}'
   export SERVICE_IP=$(kubectl get svc --namespace {{ .Release.Namespace }} {{ include "<CHARTNAME>.fullname" . }} --template "{{"{{ range (index .status.loadBalancer.ingress 0) }}{{.}}{{ end }}"}}")
   echo http://$SERVICE_IP:{{ .Values.service.port }}
-{{- else if contains "ClusterIP" .Values.service.type }}
-  export POD_NAME=$(kubectl get pods --namespace {{ .Release.Namespace }} -l "app.kubernetes.io/name={{ include "<CHARTNAME>.name" . }},app.kubernetes.io/instance={{ .Release.Name }}" -o jsonpath="{.items[0].metadata.name}")
+`,
+	},
+	{
+		resource:  ScaffoldService,
+		condition: `contains "ClusterIP" .Values.service.type`,
+		content: `  export POD_NAME=$(kubectl get pods --namespace {{ .Release.Namespace }} -l "app.kubernetes.io/name={{ include "<CHARTNAME>.name" . }},app.kubernetes.io/instance={{ .Release.Name }}" -o jsonpath="{.items[0].metadata.name}")
   export CONTAINER_PORT=$(kubectl get pod --namespace {{ .Release.Namespace }} $POD_NAME -o jsonpath="{.spec.containers[0].ports[0].containerPort}")
   echo "Visit http://127.0.0.1:8080 to use your application"
   kubectl --namespace {{ .Release.Namespace }} port-forward $POD_NAME 8080:$CONTAINER_PORT
-{{- end }}
-`
+`,
+	},
+}
 
 const defaultHelpers = `{{/*
 Expand the name of the chart.
@@ -430,24 +1295,7 @@ Expand the name of the chart.
 {{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" }}
 {{- end }}
 
-{{/*
-Create a default fully qualified app name.
-We truncate at 63 chars because some Kubernetes name fields are limited to this (by the DNS naming spec).
-If release name contains chart name it will be used as a full name.
-*/}}
-{{- define "<CHARTNAME>.fullname" -}}
-{{- if .Values.fullnameOverride }}
-{{- .Values.fullnameOverride | trunc 63 | trimSuffix "-" }}
-{{- else }}
-{{- $name := default .Chart.Name .Values.nameOverride }}
-{{- if contains $name .Release.Name }}
-{{- .Release.Name | trunc 63 | trimSuffix "-" }}
-{{- else }}
-{{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" }}
-{{- end }}
-{{- end }}
-{{- end }}
-
+<FULLNAME>
 {{/*
 Create chart name and version as used by the chart label.
 */}}
@@ -465,6 +1313,18 @@ helm.sh/chart: {{ include "<CHARTNAME>.chart" . }}
 app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
 {{- end }}
 app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- with .Values.commonLabels }}
+{{ toYaml . }}
+{{- end }}
+{{- end }}
+
+{{/*
+Common annotations
+*/}}
+{{- define "<CHARTNAME>.annotations" -}}
+{{- with .Values.commonAnnotations }}
+{{- toYaml . }}
+{{- end }}
 {{- end }}
 
 {{/*
@@ -474,8 +1334,9 @@ Selector labels
 app.kubernetes.io/name: {{ include "<CHARTNAME>.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
+`
 
-{{/*
+const defaultServiceAccountHelper = `{{/*
 Create the name of the service account to use
 */}}
 {{- define "<CHARTNAME>.serviceAccountName" -}}
@@ -487,6 +1348,24 @@ Create the name of the service account to use
 {{- end }}
 `
 
+const defaultMeshHelpers = `{{/*
+Pod labels and annotations controlling the sidecar injection of the service mesh
+*/}}
+{{- define "<CHARTNAME>.meshLabels" -}}
+{{- if eq .Values.mesh.provider "istio" -}}
+sidecar.istio.io/inject: {{ .Values.mesh.inject | quote }}
+{{- else if and .Values.mesh.provider (ne .Values.mesh.provider "linkerd") }}
+{{- fail "mesh.provider must be one of: istio, linkerd" }}
+{{- end }}
+{{- end }}
+
+{{- define "<CHARTNAME>.meshAnnotations" -}}
+{{- if eq .Values.mesh.provider "linkerd" -}}
+linkerd.io/inject: {{ ternary "enabled" "disabled" .Values.mesh.inject }}
+{{- end }}
+{{- end }}
+`
+
 const defaultTestConnection = `apiVersion: v1
 kind: Pod
 metadata:
@@ -506,48 +1385,292 @@ spec:
 
 // Stderr is an io.Writer to which error messages can be written
 //
+// It is only used when CreateOptions.Warnings or CreateFromOptions.Warnings
+// is not set, which concurrent callers should set instead of changing Stderr.
+//
 // In Helm 4, this will be replaced. It is needed in Helm 3 to preserve API backward
 // compatibility.
 var Stderr io.Writer = os.Stderr
 
+// warningsTo returns w, or Stderr when w is nil.
+func warningsTo(w io.Writer) io.Writer {
+	if w == nil {
+		return Stderr
+	}
+	return w
+}
+
 // CreateFrom creates a new chart, but scaffolds it from the src chart.
+//
+// Files of src that its .helmignore excludes are not copied; a warning naming
+// each of them is written to Stderr, or to CreateFromOptions.Warnings with
+// CreateFromWithOptions.
+//
+// The new chart is loaded and validated once it has been written; problems
+// are reported as an ErrInvalidGeneratedChart. A src that does not exist is
+// reported as an ErrChartNotFound.
 func CreateFrom(chartfile *chart.Metadata, dest, src string) error {
+	return CreateFromWithOptions(chartfile, dest, src, CreateFromOptions{})
+}
+
+// CreateFromOptions tunes how CreateFromWithOptions scaffolds a chart from a
+// starter.
+type CreateFromOptions struct {
+	// Placeholders maps placeholders in the templates and values of the
+	// starter, such as "<MODULE_NAME>", to their replacements. <CHARTNAME> is
+	// always replaced with the name of the chart and cannot be given.
+	Placeholders map[string]string
+	// RequiredLabels and RequiredAnnotations name the labels and annotations
+	// required by organization policy, as in CreateDefaults. They are added
+	// to the metadata of the templates, with placeholders in the values.
+	RequiredLabels      []string
+	RequiredAnnotations []string
+	// Check, if set, is run on the directory of the new chart once it has
+	// been validated, for checks that need to render it. The problems it
+	// returns are reported as an ErrInvalidGeneratedChart.
+	Check func(dir string) []string
+	// Warnings receives the warnings, instead of Stderr.
+	Warnings io.Writer
+}
+
+// replacer returns the replacer of <CHARTNAME> with name and of the
+// placeholders of o.
+func (o CreateFromOptions) replacer(name string) (*strings.Replacer, error) {
+	keys := []string{"<CHARTNAME>"}
+	for k := range o.Placeholders {
+		if k == "" {
+			return nil, errors.New("placeholders must not be empty")
+		}
+		if k == "<CHARTNAME>" {
+			return nil, errors.New("placeholder <CHARTNAME> is replaced with the chart name")
+		}
+		if strings.Contains(k, "\n") {
+			return nil, errors.Errorf("placeholder %q must be a single line", k)
+		}
+		keys = append(keys, k)
+	}
+	// Longer placeholders go first, so that one containing another is
+	// replaced whole.
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		if k == "<CHARTNAME>" {
+			pairs = append(pairs, k, name)
+		} else {
+			pairs = append(pairs, k, o.Placeholders[k])
+		}
+	}
+	return strings.NewReplacer(pairs...), nil
+}
+
+// CreateFromWithOptions creates a new chart from the src chart, like
+// CreateFrom, and also replaces the placeholders of opts in its templates and
+// values.
+//
+// A starter directory is copied file by file, streaming its templates and
+// values through the replacement, so that large starters are never held in
+// memory. Binary files are copied as they are.
+func CreateFromWithOptions(chartfile *chart.Metadata, dest, src string, opts CreateFromOptions) error {
+	r, err := opts.replacer(chartfile.Name)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(src)
+	if os.IsNotExist(err) {
+		return ErrChartNotFound{src}
+	}
+	if err == nil && fi.IsDir() {
+		err = copyStarter(chartfile, dest, src, r, warningsTo(opts.Warnings))
+	} else {
+		err = saveStarter(chartfile, dest, src, r)
+	}
+	if err != nil {
+		return err
+	}
+	if err := starterPolicy(filepath.Join(dest, chartfile.Name), opts.RequiredLabels, opts.RequiredAnnotations); err != nil {
+		return err
+	}
+	return validateGenerated(filepath.Join(dest, chartfile.Name), opts.Check)
+}
+
+// saveStarter loads the starter archive src and saves it as the chart of
+// chartfile in dest, with the placeholders in its templates and values
+// replaced by r.
+func saveStarter(chartfile *chart.Metadata, dest, src string, r *strings.Replacer) error {
 	schart, err := loader.Load(src)
 	if err != nil {
 		return errors.Wrapf(err, "could not load %s", src)
 	}
+	replace := func(data []byte) ([]byte, error) {
+		var b bytes.Buffer
+		err := replacePlaceholders(r, &b, bytes.NewReader(data))
+		return b.Bytes(), err
+	}
 
 	schart.Metadata = chartfile
+	for _, template := range schart.Templates {
+		if template.Data, err = replace(template.Data); err != nil {
+			return err
+		}
+	}
 
-	var updatedTemplates []*chart.File
+	// SaveDir looks for the file values.yaml when saving rather than the values
+	// key in order to preserve the comments in the YAML. The name placeholder
+	// needs to be replaced on that file only.
+	for _, f := range schart.Raw {
+		if f.Name == ValuesfileName {
+			if f.Data, err = replace(f.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return SaveDir(schart, dest)
+}
 
-	for _, template := range schart.Templates {
-		newData := transform(string(template.Data), schart.Name())
-		updatedTemplates = append(updatedTemplates, &chart.File{Name: template.Name, Data: newData})
+// copyStarter copies the starter directory src to the chart of chartfile in
+// dest one file at a time, streaming its templates and values.yaml through r.
+// chartfile is written in place of the Chart.yaml of the starter.
+//
+// What the .helmignore of the starter excludes is left out, as loading the
+// starter would, with a warning to w naming each file and directory, since
+// those would otherwise silently go missing.
+func copyStarter(chartfile *chart.Metadata, dest, src string, r *strings.Replacer, w io.Writer) error {
+	topdir, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(topdir, ChartfileName)); err != nil {
+		return errors.Wrapf(err, "could not load %s", src)
+	}
+
+	rules := ignore.Empty()
+	ifile := filepath.Join(topdir, ignore.HelmIgnore)
+	if _, err := os.Stat(ifile); err == nil {
+		rs, err := ignore.ParseFile(ifile)
+		if err != nil {
+			return err
+		}
+		rules = rs
+	}
+	rules.AddDefaults()
+
+	outdir := filepath.Join(dest, chartfile.Name)
+	if fi, err := os.Stat(outdir); err == nil && !fi.IsDir() {
+		return errors.Errorf("file %s already exists and is not a directory", outdir)
 	}
+	if err := os.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+	if err := SaveChartfile(filepath.Join(outdir, ChartfileName), chartfile); err != nil {
+		return err
+	}
+
+	topdir += string(filepath.Separator)
+	return sympath.Walk(topdir, func(name string, fi os.FileInfo, err error) error {
+		n := strings.TrimPrefix(name, topdir)
+		if n == "" || err != nil {
+			return err
+		}
+		n = filepath.ToSlash(n)
+		if rules.Ignore(n, fi) {
+			if fi.IsDir() {
+				fmt.Fprintf(w, "WARNING: Directory %q of the starter is excluded by %s and will not be copied.\n", n+"/", ignore.HelmIgnore)
+				return filepath.SkipDir
+			}
+			fmt.Fprintf(w, "WARNING: File %q of the starter is excluded by %s and will not be copied.\n", n, ignore.HelmIgnore)
+			return nil
+		}
+		if fi.IsDir() || n == ChartfileName {
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return errors.Errorf("cannot load irregular file %s as it has file mode type bits set", name)
+		}
+		replace := n == ValuesfileName || strings.HasPrefix(n, TemplatesDir+"/")
+		return copyStarterFile(filepath.Join(outdir, filepath.FromSlash(n)), name, r, replace)
+	})
+}
 
-	schart.Templates = updatedTemplates
-	b, err := yaml.Marshal(schart.Values)
+// copyStarterFile copies the file src to name, replacing the placeholders in
+// it with r when replace is set.
+func copyStarterFile(name, src string, r *strings.Replacer, replace bool) error {
+	in, err := os.Open(src)
 	if err != nil {
-		return errors.Wrap(err, "reading values file")
+		return err
 	}
+	defer in.Close()
 
-	var m map[string]interface{}
-	if err := yaml.Unmarshal(transform(string(b), schart.Name()), &m); err != nil {
-		return errors.Wrap(err, "transforming values file")
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
 	}
-	schart.Values = m
+	if replace {
+		err = replacePlaceholders(r, out, in)
+	} else {
+		_, err = io.Copy(out, in)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
 
-	// SaveDir looks for the file values.yaml when saving rather than the values
-	// key in order to preserve the comments in the YAML. The name placeholder
-	// needs to be replaced on that file.
-	for _, f := range schart.Raw {
-		if f.Name == ValuesfileName {
-			f.Data = transform(string(f.Data), schart.Name())
+// binarySniffLen is how much of a file is looked at to tell binary data from
+// text.
+const binarySniffLen = 8000
+
+// replacePlaceholders copies src to dst with the placeholders replaced by r,
+// one line at a time. Binary data, which has a NUL byte or is not valid UTF-8
+// in its first binarySniffLen bytes, is copied as it is.
+func replacePlaceholders(r *strings.Replacer, dst io.Writer, src io.Reader) error {
+	br := bufio.NewReaderSize(src, binarySniffLen)
+	head, err := br.Peek(binarySniffLen)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if isBinary(head, len(head) == binarySniffLen) {
+		_, err := io.Copy(dst, br)
+		return err
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if _, werr := r.WriteString(dst, line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 	}
+}
 
-	return SaveDir(schart, dest)
+// isBinary tells whether data is binary. When data is only the start of a
+// file, it may end in the middle of a character.
+func isBinary(data []byte, truncated bool) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	if truncated {
+		for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+			if utf8.RuneStart(data[len(data)-i]) {
+				if !utf8.FullRune(data[len(data)-i:]) {
+					data = data[:len(data)-i]
+				}
+				break
+			}
+		}
+	}
+	return !utf8.Valid(data)
 }
 
 // Create creates a new chart in a directory.
@@ -559,11 +1682,134 @@ func CreateFrom(chartfile *chart.Metadata, dest, src string) error {
 // The returned string will point to the newly created directory. It will be
 // an absolute path, even if the provided base directory was relative.
 //
+// If name is not a valid chart name, this will return an ErrNameInvalid.
 // If dir does not exist, this will return an error.
+// If the generated chart fails to load or violates its values schema, this
+// will return an ErrInvalidGeneratedChart.
 // If Chart.yaml or any directories cannot be created, this will return an
 // error. In such a case, this will attempt to clean up by removing the
 // new chart directory.
 func Create(name, dir string) (string, error) {
+	return CreateWithOptions(name, dir, CreateOptions{})
+}
+
+// CreateOptions controls which parts of the default scaffold are generated.
+type CreateOptions struct {
+	// Skip lists resources of the default scaffold, as named in
+	// ScaffoldResources, that are not generated. The values read only by those
+	// resources are left out of values.yaml as well.
+	Skip []string
+	// Only lists the resources of the default scaffold that are generated;
+	// everything else is skipped. It cannot be combined with Skip.
+	Only []string
+	// Presets lists presets, as named in Presets or by PresetDefinitions,
+	// that add the templates, values and wiring of a common kind of chart or
+	// resource to the default scaffold.
+	Presets []string
+	// PresetDefinitions are presets defined in addition to those of the
+	// default scaffold, which Presets can name.
+	PresetDefinitions []*PresetDefinition
+	// Ignore lists additional patterns written to the generated .helmignore
+	// after the default ones.
+	Ignore []string
+	// Defaults are organization-wide defaults applied to the scaffold.
+	Defaults CreateDefaults
+	// Check, if set, is run on the directory of the new chart once it has
+	// been validated, as in CreateFromOptions.
+	Check func(dir string) []string
+	// Warnings receives the warnings, instead of Stderr.
+	Warnings io.Writer
+	// Environments lists environments that each get a values-<env>.yaml
+	// with commented overrides of the scaffold values.
+	Environments []string
+	// Secrets, when set, generates a Secret passed to the container as
+	// environment variables, with its values kept in secrets.yaml instead of
+	// values.yaml. The only provider is SecretsProviderSops.
+	Secrets string
+	// Vault adds the annotations of the Vault agent injector to the pods once
+	// vault.enabled is set in values.
+	Vault bool
+	// Otel adds an OpenTelemetry Collector sidecar with a minimal pipeline,
+	// enabled with otel.enabled in values.
+	Otel bool
+	// LogSidecar adds a fluent-bit sidecar shipping the log files of the
+	// application, enabled with logSidecar.enabled in values.
+	LogSidecar bool
+	// Probe is how the liveness and readiness probes check the container,
+	// one of Probes. It defaults to ProbeHTTP.
+	Probe string
+	// TLS adds an https container port serving TLS with the certificate of a
+	// mounted Secret, which the service and the HTTP probes use once
+	// tls.enabled is set in values.
+	TLS bool
+	// Persistence generates a PersistentVolumeClaim mounted into the
+	// application, enabled with persistence.enabled in values, which can
+	// also name an existing claim.
+	Persistence bool
+	// Arch pins the pods to nodes of one CPU architecture, such as "arm64",
+	// with a kubernetes.io/arch node selector and a toleration of the taint
+	// commonly keeping other workloads off those nodes.
+	Arch string
+	// GPU requests one GPU of a vendor in the default resources, and adds the
+	// runtime class and toleration GPU nodes commonly need. The only vendor
+	// is GPUNvidia.
+	GPU string
+	// Spot tolerates the nodes of spot or preemptible node pools, labelled
+	// and tainted with CreateDefaults.SpotNodeLabel, and prefers them over
+	// other nodes.
+	Spot bool
+	// Description, Version, AppVersion and APIVersion replace the
+	// description, the chart version, the app version and the API version of
+	// the default Chart.yaml when set. The chart version must be a semantic
+	// version and the API version one of chart.APIVersionV1 and
+	// chart.APIVersionV2.
+	Description string
+	Version     string
+	AppVersion  string
+	APIVersion  string
+	// OriginalName is the name the chart was asked for, when the chart is
+	// named differently, such as a Unicode name turned into a chart name by
+	// SanitizeChartName. It is recorded in Chart.yaml under
+	// OriginalNameAnnotation.
+	OriginalName string
+	// LicenseHeader, such as "SPDX-License-Identifier: Apache-2.0", is
+	// written as a template comment at the top of every generated template,
+	// which renders to nothing. It defaults to Defaults.LicenseHeader.
+	LicenseHeader string
+	// ArtifactHub adds the annotations Artifact Hub reads to Chart.yaml: the
+	// license, taken from an SPDX LicenseHeader, the links, the images and
+	// the changes of the first release.
+	ArtifactHub bool
+	// Fullname is the composition of the fully qualified app name that names
+	// the generated resources, one of FullnameFormats. It defaults to
+	// FullnameReleaseChart.
+	Fullname string
+	// FullnameLength is the length the fully qualified app name is
+	// truncated to, at most and by default DefaultFullnameLength.
+	FullnameLength int
+	// FullnameHash makes a fully qualified app name longer than
+	// FullnameLength end with a hash of the whole name when it is truncated,
+	// so that names that only differ past the cut do not collide.
+	FullnameHash bool
+	// Dependencies are written to Chart.yaml, each with a condition on
+	// <name>.enabled, and get a values stub enabling them. Their versions
+	// may be semantic version ranges.
+	Dependencies []*chart.Dependency
+	// Home, Keywords and Maintainers are written to Chart.yaml. Each one
+	// that is not set is taken from the Defaults.
+	Home        string
+	Keywords    []string
+	Maintainers []*chart.Maintainer
+	// WorkloadIdentity adds commented service account annotations, and the
+	// template wiring they need, for the workload identity of a cloud
+	// provider: WorkloadIdentityGKE, WorkloadIdentityEKS or
+	// WorkloadIdentityAKS.
+	WorkloadIdentity string
+}
+
+// CreateWithOptions creates a new chart in a directory, like Create, with the
+// parts of the default scaffold chosen by opts.
+func CreateWithOptions(name, dir string, opts CreateOptions) (string, error) {
 
 	// Sanity-check the name of a chart so user doesn't create one that causes problems.
 	if err := validateChartName(name); err != nil {
@@ -581,78 +1827,317 @@ func Create(name, dir string) (string, error) {
 		return path, errors.Errorf("no such directory %s", path)
 	}
 
+	want, err := opts.resources()
+	if err != nil {
+		return path, err
+	}
+	// The presets that the presets of opts build on are applied with them.
+	opts.Presets = opts.presetNames()
+	if opts.Vault && !want[ScaffoldDeployment] {
+		return path, errors.Errorf("vault requires %q", ScaffoldDeployment)
+	}
+	if opts.LogSidecar && !want[ScaffoldDeployment] {
+		return path, errors.Errorf("log sidecar requires %q", ScaffoldDeployment)
+	}
+	switch opts.Probe {
+	case "", ProbeHTTP:
+	case ProbeGRPC, ProbeTCP, ProbeExec:
+		if !want[ScaffoldDeployment] {
+			return path, errors.Errorf("probe requires %q", ScaffoldDeployment)
+		}
+	default:
+		return path, errors.Errorf("unknown probe %q, expected one of: %s", opts.Probe, strings.Join(Probes, ", "))
+	}
+	if opts.TLS && !want[ScaffoldDeployment] {
+		return path, errors.Errorf("tls requires %q", ScaffoldDeployment)
+	}
+	if opts.Persistence && !want[ScaffoldDeployment] {
+		return path, errors.Errorf("persistence requires %q", ScaffoldDeployment)
+	}
+	if opts.Otel && !want[ScaffoldDeployment] {
+		return path, errors.Errorf("otel requires %q", ScaffoldDeployment)
+	}
+	for _, p := range opts.presets() {
+		if p.check == nil {
+			continue
+		}
+		if err := p.check(opts, want); err != nil {
+			return path, err
+		}
+	}
+	if opts.Arch != "" {
+		if !isArch(opts.Arch) {
+			return path, errors.Errorf("unknown architecture %q, expected one of: %s", opts.Arch, strings.Join(Architectures, ", "))
+		}
+		if !want[ScaffoldDeployment] {
+			return path, errors.Errorf("arch requires %q", ScaffoldDeployment)
+		}
+	}
+	if opts.GPU != "" {
+		if _, ok := gpuResources[opts.GPU]; !ok {
+			return path, errors.Errorf("unknown GPU vendor %q, expected: %s", opts.GPU, GPUNvidia)
+		}
+		if !want[ScaffoldDeployment] {
+			return path, errors.Errorf("gpu requires %q", ScaffoldDeployment)
+		}
+	}
+	if opts.Spot {
+		if _, _, err := spotNodeLabel(opts.Defaults); err != nil {
+			return path, err
+		}
+		if !want[ScaffoldDeployment] {
+			return path, errors.Errorf("spot requires %q", ScaffoldDeployment)
+		}
+	}
+	if opts.WorkloadIdentity != "" {
+		if _, ok := workloadIdentityAnnotations[opts.WorkloadIdentity]; !ok {
+			return path, errors.Errorf("unknown workload identity provider %q, expected one of: %s, %s, %s", opts.WorkloadIdentity, WorkloadIdentityGKE, WorkloadIdentityEKS, WorkloadIdentityAKS)
+		}
+		if !want[ScaffoldServiceAccount] {
+			return path, errors.Errorf("workload identity requires %q", ScaffoldServiceAccount)
+		}
+	}
+	ignorePatterns := append(append([]string{}, opts.Defaults.Ignore...), opts.Ignore...)
+	switch opts.Secrets {
+	case "":
+	case SecretsProviderSops:
+		if !want[ScaffoldDeployment] {
+			return path, errors.Errorf("secrets require %q", ScaffoldDeployment)
+		}
+		// The sensitive values must never end up in a chart archive.
+		ignorePatterns = append(ignorePatterns, SecretsValuesfileName)
+	default:
+		return path, errors.Errorf("unknown secrets provider %q, expected %q", opts.Secrets, SecretsProviderSops)
+	}
+	for _, p := range opts.presets() {
+		ignorePatterns = append(ignorePatterns, p.ignore...)
+	}
+	header := opts.licenseHeader()
+	if strings.Contains(header, "*/") {
+		return path, errors.New("license header must not contain */")
+	}
+	chartfile, err := chartfile(name, opts)
+	if err != nil {
+		return path, err
+	}
+	helmignore, err := ignorefile(ignorePatterns)
+	if err != nil {
+		return path, err
+	}
+	valuesfile, err := values(name, want, opts)
+	if err != nil {
+		return path, err
+	}
+	helpersfile, err := helpers(name, want, opts)
+	if err != nil {
+		return path, err
+	}
+	deploymentTemplate, err := deployment(want, opts)
+	if err != nil {
+		return path, err
+	}
+	serviceTemplate, err := service(opts)
+	if err != nil {
+		return path, err
+	}
+	// The templates of the resources get the annotations helper, and the
+	// required labels on their pods.
+	templates := map[string]string{
+		IngressFileName:             defaultIngress,
+		DeploymentName:              deploymentTemplate,
+		ServiceName:                 serviceTemplate,
+		ServiceAccountName:          defaultServiceAccount,
+		HorizontalPodAutoscalerName: defaultHorizontalPodAutoscaler,
+		TestConnectionName:          defaultTestConnection,
+		OtelConfigMapName:           defaultOtelConfigMap,
+		LogConfigMapName:            defaultLogConfigMap,
+		PersistentVolumeClaimName:   defaultPersistentVolumeClaim,
+		SecretName:                  defaultSecret,
+	}
+	for f, src := range templates {
+		if templates[f], err = resourceTemplate(src, opts.Defaults); err != nil {
+			return path, err
+		}
+	}
+	warnNameLength(name, opts)
+
 	cdir := filepath.Join(path, name)
 	if fi, err := os.Stat(cdir); err == nil && !fi.IsDir() {
 		return cdir, errors.Errorf("file %s already exists and is not a directory", cdir)
 	}
 
-	files := []struct {
-		path    string
-		content []byte
-	}{
+	files := []scaffoldFile{
 		{
 			// Chart.yaml
 			path:    filepath.Join(cdir, ChartfileName),
-			content: []byte(fmt.Sprintf(defaultChartfile, name)),
+			content: chartfile,
 		},
 		{
 			// values.yaml
 			path:    filepath.Join(cdir, ValuesfileName),
-			content: []byte(fmt.Sprintf(defaultValues, name)),
+			content: valuesfile,
 		},
 		{
 			// .helmignore
 			path:    filepath.Join(cdir, IgnorefileName),
-			content: []byte(defaultIgnore),
+			content: helmignore,
 		},
 		{
 			// ingress.yaml
-			path:    filepath.Join(cdir, IngressFileName),
-			content: transform(defaultIngress, name),
+			path:     filepath.Join(cdir, IngressFileName),
+			content:  transform(templates[IngressFileName], name),
+			resource: ScaffoldIngress,
 		},
 		{
 			// deployment.yaml
-			path:    filepath.Join(cdir, DeploymentName),
-			content: transform(defaultDeployment, name),
+			path:     filepath.Join(cdir, DeploymentName),
+			content:  transform(templates[DeploymentName], name),
+			resource: ScaffoldDeployment,
 		},
 		{
 			// service.yaml
-			path:    filepath.Join(cdir, ServiceName),
-			content: transform(defaultService, name),
+			path:     filepath.Join(cdir, ServiceName),
+			content:  transform(templates[ServiceName], name),
+			resource: ScaffoldService,
 		},
 		{
 			// serviceaccount.yaml
-			path:    filepath.Join(cdir, ServiceAccountName),
-			content: transform(defaultServiceAccount, name),
+			path:     filepath.Join(cdir, ServiceAccountName),
+			content:  transform(templates[ServiceAccountName], name),
+			resource: ScaffoldServiceAccount,
 		},
 		{
 			// hpa.yaml
-			path:    filepath.Join(cdir, HorizontalPodAutoscalerName),
-			content: transform(defaultHorizontalPodAutoscaler, name),
+			path:     filepath.Join(cdir, HorizontalPodAutoscalerName),
+			content:  transform(templates[HorizontalPodAutoscalerName], name),
+			resource: ScaffoldHorizontalPodAutoscaler,
 		},
 		{
 			// NOTES.txt
-			path:    filepath.Join(cdir, NotesName),
-			content: transform(defaultNotes, name),
+			path:     filepath.Join(cdir, NotesName),
+			content:  transform(notes(want), name),
+			resource: ScaffoldDeployment,
 		},
 		{
 			// _helpers.tpl
 			path:    filepath.Join(cdir, HelpersName),
-			content: transform(defaultHelpers, name),
+			content: helpersfile,
 		},
 		{
 			// test-connection.yaml
-			path:    filepath.Join(cdir, TestConnectionName),
-			content: transform(defaultTestConnection, name),
+			path:     filepath.Join(cdir, TestConnectionName),
+			content:  transform(templates[TestConnectionName], name),
+			resource: ScaffoldTests,
 		},
 	}
 
+	if opts.Otel {
+		files = append(files, scaffoldFile{
+			path:    filepath.Join(cdir, OtelConfigMapName),
+			content: transform(templates[OtelConfigMapName], name),
+		})
+	}
+	if opts.LogSidecar {
+		files = append(files, scaffoldFile{
+			path:    filepath.Join(cdir, LogConfigMapName),
+			content: transform(templates[LogConfigMapName], name),
+		})
+	}
+	if opts.Persistence {
+		files = append(files, scaffoldFile{
+			path:    filepath.Join(cdir, PersistentVolumeClaimName),
+			content: transform(templates[PersistentVolumeClaimName], name),
+		})
+	}
+	if opts.Secrets != "" {
+		files = append(files,
+			scaffoldFile{
+				path:    filepath.Join(cdir, SecretName),
+				content: transform(templates[SecretName], name),
+			},
+			scaffoldFile{
+				path:      filepath.Join(cdir, SecretsValuesfileName),
+				content:   transform(defaultSopsSecretsValues, name),
+				sensitive: true,
+			},
+		)
+	}
+
+	for _, p := range opts.presets() {
+		for _, f := range p.files {
+			content := presetTemplate(f.content, opts.Defaults)
+			if !f.hook {
+				content = podsTemplate(content, opts)
+			}
+			file := scaffoldFile{
+				path:      filepath.Join(cdir, f.path),
+				content:   transform(content, name),
+				sensitive: f.sensitive,
+			}
+			replaced := false
+			for i := range files {
+				// A preset file replaces the scaffold file at its path.
+				if files[i].path == file.path {
+					files[i], replaced = file, true
+				}
+			}
+			if !replaced {
+				files = append(files, file)
+			}
+		}
+		for from, to := range p.paths {
+			renamed := false
+			for i := range files {
+				if files[i].path == filepath.Join(cdir, from) {
+					files[i].path, renamed = filepath.Join(cdir, to), true
+				}
+			}
+			if !renamed {
+				return cdir, errors.Errorf("cannot rename %s, which is not a file of the scaffold", from)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, env := range opts.Environments {
+		if !chartName.MatchString(env) {
+			return cdir, ErrNameInvalid{Kind: "environment", Name: env, Reason: fmt.Sprintf("must match the regular expression %q", chartName.String())}
+		}
+		if seen[env] {
+			return cdir, errors.Errorf("environment %q is given more than once", env)
+		}
+		seen[env] = true
+		files = append(files, scaffoldFile{
+			path:    filepath.Join(cdir, fmt.Sprintf(EnvironmentValuesfileName, env)),
+			content: environmentValues(name, env, want),
+		})
+	}
+
+	switch opts.Defaults.TemplateIndent {
+	case 0, 2, 4:
+	default:
+		return cdir, errors.Errorf("template indent must be 2 or 4, got %d", opts.Defaults.TemplateIndent)
+	}
+	templatesDir := filepath.Join(cdir, TemplatesDir) + sep
 	for _, file := range files {
+		if file.resource != "" && !want[file.resource] {
+			continue
+		}
+		if opts.Defaults.TemplateIndent == 4 && strings.HasPrefix(file.path, templatesDir) && filepath.Ext(file.path) == ".yaml" {
+			file.content = indentTemplate(file.content)
+		}
+		if header != "" && strings.HasPrefix(file.path, templatesDir) {
+			file.content = append(headerComment(header), file.content...)
+		}
 		if _, err := os.Stat(file.path); err == nil {
 			// There is no handle to a preferred output stream here.
-			fmt.Fprintf(Stderr, "WARNING: File %q already exists. Overwriting.\n", file.path)
+			fmt.Fprintf(warningsTo(opts.Warnings), "WARNING: File %q already exists. Overwriting.\n", file.path)
+		}
+		write := writeFile
+		if file.sensitive {
+			write = writeSensitiveFile
 		}
-		if err := writeFile(file.path, file.content); err != nil {
+		if err := write(file.path, file.content); err != nil {
 			return cdir, err
 		}
 	}
@@ -660,28 +2145,1516 @@ func Create(name, dir string) (string, error) {
 	if err := os.MkdirAll(filepath.Join(cdir, ChartsDir), 0755); err != nil {
 		return cdir, err
 	}
-	return cdir, nil
+	return cdir, validateGenerated(cdir, opts.Check)
 }
 
-// transform performs a string replacement of the specified source for
-// a given key with the replacement string
-func transform(src, replacement string) []byte {
-	return []byte(strings.ReplaceAll(src, "<CHARTNAME>", replacement))
+// containerPort returns the port of the container of the deployment.
+func (o CreateOptions) containerPort() int {
+	if o.Defaults.Port != 0 {
+		return o.Defaults.Port
+	}
+	return 80
 }
 
-func writeFile(name string, content []byte) error {
-	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
-		return err
+// licenseHeader returns the license header of the generated templates.
+func (o CreateOptions) licenseHeader() string {
+	if o.LicenseHeader != "" {
+		return o.LicenseHeader
 	}
-	return ioutil.WriteFile(name, content, 0644)
+	return o.Defaults.LicenseHeader
+}
+
+// headerComment renders header as a template comment, trimming the newline
+// after it so that the rendered template is unchanged.
+func headerComment(header string) []byte {
+	return []byte("{{- /*\n" + strings.TrimRight(header, "\n") + "\n*/ -}}\n")
+}
+
+// indentCalls matches the indent and nindent calls of a template.
+var indentCalls = regexp.MustCompile(`\b(n?indent) (\d+)\b`)
+
+// indentTemplate indents the template src by 4 spaces instead of 2, doubling
+// the indentation of its lines and the one its indent and nindent calls add.
+func indentTemplate(src []byte) []byte {
+	var sb strings.Builder
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		content := strings.TrimLeft(line, " ")
+		line = strings.Repeat(" ", 2*(len(line)-len(content))) + content
+		sb.WriteString(indentCalls.ReplaceAllStringFunc(line, func(call string) string {
+			m := indentCalls.FindStringSubmatch(call)
+			n, _ := strconv.Atoi(m[2])
+			return fmt.Sprintf("%s %d", m[1], 2*n)
+		}))
+	}
+	return []byte(sb.String())
+}
+
+// scaffoldFile is a file written by CreateWithOptions. It is only written when
+// resource is empty or is one of the generated scaffold resources. Sensitive
+// files, which hold or are meant to hold credentials, are only readable by
+// their owner.
+type scaffoldFile struct {
+	path      string
+	content   []byte
+	resource  string
+	sensitive bool
+}
+
+// resources returns the set of scaffold resources to generate, without those
+// the presets leave out. It is an error to name an unknown resource or
+// preset, or to skip a resource that another generated resource or a preset
+// refers to.
+func (o CreateOptions) resources() (map[string]bool, error) {
+	if len(o.Skip) > 0 && len(o.Only) > 0 {
+		return nil, errors.New("Skip and Only cannot both be set")
+	}
+
+	want := map[string]bool{}
+	for _, r := range ScaffoldResources {
+		want[r] = len(o.Only) == 0
+	}
+	set := func(names []string, value bool) error {
+		for _, r := range names {
+			if _, ok := want[r]; !ok {
+				return ErrUnknownScaffoldResource{r}
+			}
+			want[r] = value
+		}
+		return nil
+	}
+	if err := set(o.Skip, false); err != nil {
+		return nil, err
+	}
+	if err := set(o.Only, true); err != nil {
+		return nil, err
+	}
+	only := map[string]bool{}
+	for _, r := range o.Only {
+		only[r] = true
+	}
+	for _, name := range o.presetNames() {
+		p, ok := o.preset(name)
+		if !ok {
+			names := append([]string{}, Presets...)
+			for _, d := range o.PresetDefinitions {
+				names = append(names, d.Name)
+			}
+			return nil, errors.Errorf("unknown preset %q, expected one of: %s", name, strings.Join(names, ", "))
+		}
+		for _, r := range p.without {
+			if only[r] {
+				return nil, errors.Errorf("preset %q leaves out %q", name, r)
+			}
+			want[r] = false
+		}
+	}
+	for _, r := range ScaffoldResources {
+		if !want[r] {
+			continue
+		}
+		for _, dep := range scaffoldRequires[r] {
+			if !want[dep] {
+				return nil, errors.Errorf("scaffold resource %q requires %q", r, dep)
+			}
+		}
+	}
+	for _, name := range o.presetNames() {
+		p, _ := o.preset(name)
+		for _, r := range p.requires {
+			if !want[r] {
+				return nil, errors.Errorf("preset %q requires %q", name, r)
+			}
+		}
+	}
+	return want, nil
+}
+
+// ApplyMetadata sets the chart metadata given in o on md, taking the home,
+// keywords and maintainers from the Defaults when o does not set them. Fields
+// set in neither are left alone.
+func (o CreateOptions) ApplyMetadata(md *chart.Metadata) {
+	if o.Description != "" {
+		md.Description = o.Description
+	}
+	if o.Version != "" {
+		md.Version = o.Version
+	}
+	if o.AppVersion != "" {
+		md.AppVersion = o.AppVersion
+	}
+	if o.APIVersion != "" {
+		md.APIVersion = o.APIVersion
+	}
+	switch {
+	case o.Home != "":
+		md.Home = o.Home
+	case o.Defaults.Home != "":
+		md.Home = o.Defaults.Home
+	}
+	switch {
+	case len(o.Keywords) > 0:
+		md.Keywords = o.Keywords
+	case len(o.Defaults.Keywords) > 0:
+		md.Keywords = o.Defaults.Keywords
+	}
+	switch {
+	case len(o.Maintainers) > 0:
+		md.Maintainers = o.Maintainers
+	case len(o.Defaults.Maintainers) > 0:
+		md.Maintainers = o.Defaults.Maintainers
+	}
+	if o.OriginalName != "" {
+		if md.Annotations == nil {
+			md.Annotations = map[string]string{}
+		}
+		md.Annotations[OriginalNameAnnotation] = o.OriginalName
+	}
+}
+
+// chartfile returns Chart.yaml with the metadata given in opts in place of the
+// default one.
+func chartfile(name string, opts CreateOptions) ([]byte, error) {
+	c := fmt.Sprintf(defaultChartfile, name)
+	var err error
+	switch opts.APIVersion {
+	case "", chart.APIVersionV2:
+	case chart.APIVersionV1:
+		if c, err = replaceAnchors(c, "apiVersion: v2\n", "apiVersion: v1\n"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unknown chart API version %q, expected %s or %s", opts.APIVersion, chart.APIVersionV1, chart.APIVersionV2)
+	}
+	if opts.Version != "" {
+		if _, err := semver.NewVersion(opts.Version); err != nil {
+			return nil, errors.Wrapf(err, "chart version %q is not a valid semantic version", opts.Version)
+		}
+		// A version such as 1.0 must be quoted to stay a string.
+		b, err := yaml.Marshal(map[string]string{"version": opts.Version})
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering chart version")
+		}
+		if c, err = replaceAnchors(c, "\nversion: 0.1.0\n", "\n"+string(b)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Description != "" {
+		b, err := yaml.Marshal(map[string]string{"description": opts.Description})
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering chart description")
+		}
+		if c, err = replaceAnchors(c, "description: A Helm chart for Kubernetes\n", string(b)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.AppVersion != "" {
+		// Quoted, as the comment above it recommends.
+		if c, err = replaceAnchors(c, "appVersion: \"1.16.0\"\n", fmt.Sprintf("appVersion: %q\n", opts.AppVersion)); err != nil {
+			return nil, err
+		}
+	}
+
+	md := new(chart.Metadata)
+	opts.ApplyMetadata(md)
+	for _, m := range md.Maintainers {
+		if m == nil || m.Name == "" {
+			return nil, errors.New("chart maintainers must have a name")
+		}
+	}
+	if md.Home != "" || len(md.Keywords) > 0 || len(md.Maintainers) > 0 {
+		b, err := yaml.Marshal(struct {
+			Home        string              `json:"home,omitempty"`
+			Keywords    []string            `json:"keywords,omitempty"`
+			Maintainers []*chart.Maintainer `json:"maintainers,omitempty"`
+		}{md.Home, md.Keywords, md.Maintainers})
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering chart metadata")
+		}
+		c += "\n" + string(b)
+	}
+	if len(opts.Dependencies) > 0 {
+		if opts.APIVersion == chart.APIVersionV1 {
+			return nil, errors.Errorf("dependencies require chart API version %s", chart.APIVersionV2)
+		}
+		deps, err := dependencies(opts.Dependencies)
+		if err != nil {
+			return nil, err
+		}
+		b, err := yaml.Marshal(map[string][]*chart.Dependency{"dependencies": deps})
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering chart dependencies")
+		}
+		c += "\n# Run 'helm dependency update' to download the dependencies into charts/.\n" + string(b)
+	}
+	var annotations string
+	if opts.OriginalName != "" {
+		b, err := yaml.Marshal(map[string]map[string]string{"annotations": md.Annotations})
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering chart annotations")
+		}
+		annotations = string(b)
+	}
+	if opts.ArtifactHub {
+		hub := artifactHubAnnotations(name, md, opts)
+		if annotations != "" {
+			if hub, err = replaceAnchors(hub, "annotations:\n", annotations); err != nil {
+				return nil, err
+			}
+		}
+		c += "\n" + hub
+	} else if annotations != "" {
+		c += "\n" + annotations
+	}
+	return []byte(c), nil
+}
+
+// dependencies validates deps and returns them with their default condition.
+func dependencies(deps []*chart.Dependency) ([]*chart.Dependency, error) {
+	seen := map[string]bool{}
+	out := make([]*chart.Dependency, len(deps))
+	for i, d := range deps {
+		if !chartName.MatchString(d.Name) {
+			return nil, ErrNameInvalid{Kind: "dependency", Name: d.Name, Reason: fmt.Sprintf("must match the regular expression %q", chartName.String())}
+		}
+		if d.Version != "" {
+			if _, err := semver.NewConstraint(d.Version); err != nil {
+				return nil, errors.Wrapf(err, "dependency %s has an invalid version %q", d.Name, d.Version)
+			}
+		}
+		dep := *d
+		if err := dep.Validate(); err != nil {
+			return nil, err
+		}
+		key := dependencyKey(&dep)
+		if seen[key] {
+			return nil, errors.Errorf("dependency %q is given more than once", key)
+		}
+		seen[key] = true
+		if dep.Condition == "" {
+			dep.Condition = key + ".enabled"
+		}
+		out[i] = &dep
+	}
+	return out, nil
+}
+
+// dependencyKey returns the key of the values of a dependency.
+func dependencyKey(d *chart.Dependency) string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	return d.Name
+}
+
+const dependencyValues = `# Values passed to the <DEPENDENCY> dependency, which is only installed while
+# <DEPENDENCY>.enabled is true. See the values.yaml of the dependency for the
+# others.
+<DEPENDENCY>:
+  enabled: true
+`
+
+// spdxPrefix starts a license header naming the license of the chart.
+const spdxPrefix = "SPDX-License-Identifier:"
+
+// artifactHubAnnotations renders the Artifact Hub annotations of Chart.yaml,
+// leaving commented examples for what cannot be told from opts.
+func artifactHubAnnotations(name string, md *chart.Metadata, opts CreateOptions) string {
+	var license string
+	for _, line := range strings.Split(opts.licenseHeader(), "\n") {
+		if l := strings.TrimSpace(line); strings.HasPrefix(l, spdxPrefix) {
+			license = strings.TrimSpace(l[len(spdxPrefix):])
+		}
+	}
+	image := "nginx"
+	if opts.Defaults.ImageRegistry != "" {
+		image = strings.TrimSuffix(opts.Defaults.ImageRegistry, "/") + "/" + image
+	}
+	appVersion := opts.AppVersion
+	if appVersion == "" {
+		appVersion = "1.16.0"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Annotations read by Artifact Hub to list the chart, see\n")
+	sb.WriteString("# https://artifacthub.io/docs/topics/annotations/helm/\n")
+	sb.WriteString("annotations:\n")
+	if license != "" {
+		fmt.Fprintf(&sb, "  artifacthub.io/license: %s\n", license)
+	} else {
+		sb.WriteString("  # artifacthub.io/license: Apache-2.0\n")
+	}
+	if md.Home != "" {
+		fmt.Fprintf(&sb, "  artifacthub.io/links: |\n    - name: Homepage\n      url: %s\n", md.Home)
+	} else {
+		sb.WriteString("  # artifacthub.io/links: |\n  #   - name: Homepage\n  #     url: https://example.com\n")
+	}
+	sb.WriteString("  artifacthub.io/images: |\n")
+	fmt.Fprintf(&sb, "    - name: %s\n      image: %s:%s\n", name, image, appVersion)
+	sb.WriteString("  artifacthub.io/changes: |\n")
+	sb.WriteString("    - kind: added\n      description: Initial release\n")
+	return sb.String()
+}
+
+// ignorefile returns the .helmignore with the default patterns followed by
+// the given ones. Patterns that the ignore rules parser rejects are an error.
+func ignorefile(patterns []string) ([]byte, error) {
+	if len(patterns) == 0 {
+		return []byte(defaultIgnore), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(defaultIgnore)
+	sb.WriteString("# Additional patterns\n")
+	for _, p := range patterns {
+		if strings.ContainsAny(p, "\r\n") {
+			return nil, errors.Errorf("ignore pattern %q must be a single line", p)
+		}
+		if _, err := ignore.Parse(strings.NewReader(p)); err != nil {
+			return nil, errors.Wrapf(err, "invalid ignore pattern %q", p)
+		}
+		sb.WriteString(p)
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// values assembles values.yaml from the sections needed by the wanted
+// resources and applies the defaults to it.
+func values(name string, want map[string]bool, opts CreateOptions) ([]byte, error) {
+	d := opts.Defaults
+	var sb strings.Builder
+	for _, section := range defaultValues {
+		if section.resource == "" || want[section.resource] {
+			sb.WriteString(section.content)
+		}
+	}
+	v := string(transform(strings.TrimRight(sb.String(), "\n")+"\n", name))
+	if opts.Vault {
+		v += "\n" + string(transform(defaultVaultValues, name))
+	}
+	for _, p := range opts.presets() {
+		if p.values != "" {
+			v += "\n" + string(transform(p.values, name))
+		}
+	}
+	for _, p := range opts.presets() {
+		keys := make([]string, 0, len(p.set))
+		for k := range p.set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var err error
+			if v, err = setValue(v, k, p.set[k]); err != nil {
+				return nil, err
+			}
+		}
+		for _, k := range p.unset {
+			var err error
+			if v, err = unsetValue(v, k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.Otel {
+		v += "\n" + defaultOtelValues
+	}
+	if opts.LogSidecar {
+		v += "\n" + defaultLogValues
+	}
+	if opts.Persistence {
+		v += "\n" + defaultPersistenceValues
+	}
+	if opts.TLS {
+		v += "\n" + defaultTLSValues
+	}
+	if opts.Secrets != "" {
+		v += "\n" + secretsValuesComment
+	}
+	if opts.Arch != "" || opts.GPU != "" || opts.Spot {
+		block, err := schedulingValues(opts)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = replaceAnchors(v, "nodeSelector: {}\n\ntolerations: []\n\naffinity: {}\n", block); err != nil {
+			return nil, err
+		}
+	}
+	if opts.WorkloadIdentity != "" {
+		comment := string(transform(workloadIdentityAnnotations[opts.WorkloadIdentity], name))
+		var err error
+		if v, err = replaceAnchors(v, serviceAccountAnnotations, serviceAccountAnnotations+comment); err != nil {
+			return nil, err
+		}
+	}
+
+	var images []string
+	if want[ScaffoldDeployment] {
+		images = append(images, "image")
+	}
+	for _, p := range opts.presets() {
+		images = append(images, p.images...)
+	}
+	if d.ImageRegistry != "" || d.ImagePullPolicy != "" {
+		var current map[string]interface{}
+		if err := yaml.Unmarshal([]byte(v), &current); err != nil {
+			return nil, errors.Wrap(err, "parsing default values")
+		}
+		for _, key := range images {
+			if d.ImageRegistry != "" {
+				repository, err := Values(current).PathValue(key + ".repository")
+				if err != nil {
+					return nil, err
+				}
+				if v, err = setValue(v, key+".repository", fmt.Sprintf("%s/%v", strings.TrimSuffix(d.ImageRegistry, "/"), repository)); err != nil {
+					return nil, err
+				}
+			}
+			if d.ImagePullPolicy != "" {
+				var err error
+				if v, err = setValue(v, key+".pullPolicy", d.ImagePullPolicy); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if d.Port != 0 && want[ScaffoldService] {
+		var err error
+		if v, err = setValue(v, "service.port", d.Port); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.PodAnnotations) > 0 && want[ScaffoldDeployment] {
+		block, err := yamlBlock("podAnnotations", d.PodAnnotations)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = replaceAnchors(v, "podAnnotations: {}\n", block); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.RequiredLabels) > 0 || len(d.RequiredAnnotations) > 0 {
+		policy, err := policyValues(d.RequiredLabels, d.RequiredAnnotations)
+		if err != nil {
+			return nil, err
+		}
+		v += "\n" + policy
+	}
+	resources := d.Resources
+	if opts.GPU != "" {
+		resources = withGPULimit(resources, opts.GPU)
+	}
+	if len(resources) > 0 && want[ScaffoldDeployment] {
+		// The comment under the default resources, explaining why they are
+		// empty, goes with them.
+		var err error
+		if v, err = setValue(v, "resources", resources); err != nil {
+			return nil, err
+		}
+	}
+	// The values of the dependencies come last, once the top-level keys of
+	// all the others are known.
+	if len(opts.Dependencies) > 0 {
+		var keys map[string]interface{}
+		if err := yaml.Unmarshal([]byte(v), &keys); err != nil {
+			return nil, errors.Wrap(err, "parsing default values")
+		}
+		if keys == nil {
+			keys = map[string]interface{}{}
+		}
+		for _, d := range opts.Dependencies {
+			key := dependencyKey(d)
+			if _, ok := keys[key]; ok {
+				return nil, ErrDependencyValuesConflict{key}
+			}
+			keys[key] = true
+			v += "\n" + strings.ReplaceAll(dependencyValues, "<DEPENDENCY>", key)
+		}
+	}
+	return valuesStyle(v, d)
+}
+
+// valuesStyle indents, comments and quotes the values v in the style set by
+// d.
+func valuesStyle(v string, d CreateDefaults) ([]byte, error) {
+	switch d.ValuesIndent {
+	case 0, 2, 4:
+	default:
+		return nil, errors.Errorf("values indent must be 2 or 4, got %d", d.ValuesIndent)
+	}
+	comments := d.ValuesComments
+	switch comments {
+	case "":
+		comments = ValuesCommentsFull
+	case ValuesCommentsFull, ValuesCommentsMinimal, ValuesCommentsNone:
+	default:
+		return nil, errors.Errorf("unknown values comments %q, expected one of: %s, %s, %s", comments, ValuesCommentsFull, ValuesCommentsMinimal, ValuesCommentsNone)
+	}
+	switch d.ValuesQuote {
+	case "", ValuesQuoteDouble, ValuesQuoteSingle:
+	default:
+		return nil, errors.Errorf("unknown values quote %q, expected %s or %s", d.ValuesQuote, ValuesQuoteDouble, ValuesQuoteSingle)
+	}
+	if d.ValuesIndent != 4 && comments == ValuesCommentsFull && d.ValuesQuote == "" {
+		return []byte(v), nil
+	}
+
+	var sb strings.Builder
+	blank := true
+	// The indent of the key of the block scalar the lines belong to, if any.
+	block := -1
+	for _, line := range strings.SplitAfter(v, "\n") {
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		if block >= 0 && (indent > block || strings.TrimSpace(line) == "") {
+			// The content of a block scalar is kept as it is, apart from
+			// its indentation.
+		} else if strings.HasPrefix(content, "#") {
+			if comments == ValuesCommentsNone || comments == ValuesCommentsMinimal && indent > 0 {
+				continue
+			}
+		} else {
+			block = -1
+			if m := valuesScalar.FindStringSubmatch(strings.TrimRight(content, "\n")); m != nil {
+				if blockScalar.MatchString(m[2]) {
+					block = indent
+				} else if d.ValuesQuote != "" {
+					content = m[1] + quoteScalar(m[2], d.ValuesQuote) + "\n"
+				}
+			}
+		}
+		// Left out comments would leave several blank lines in a row.
+		if strings.TrimSpace(line) == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		if d.ValuesIndent == 4 {
+			indent *= 2
+		}
+		sb.WriteString(strings.Repeat(" ", indent) + content)
+	}
+	return []byte(strings.TrimRight(sb.String(), "\n") + "\n"), nil
+}
+
+// valuesScalar matches a mapping entry or a sequence item of values.yaml with
+// a value on the same line, and blockScalar the header of a block scalar.
+var (
+	valuesScalar = regexp.MustCompile(`^((?:- )?[\w./-]+: |- )(.+)$`)
+	blockScalar  = regexp.MustCompile(`^[|>][-+]?[0-9]?$`)
+)
+
+// quoteScalar quotes the plain or quoted string value in the given style.
+// Other values, and strings that cannot be requoted without escaping, are
+// returned as they are.
+func quoteScalar(value, style string) string {
+	if strings.Contains(value, " #") || strings.ContainsAny(value[:1], "{[&*!|>%@`") {
+		return value
+	}
+	s := value
+	switch {
+	case len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\''):
+		s = s[1 : len(s)-1]
+	case s[0] == '"' || s[0] == '\'':
+		return value
+	default:
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return value
+		}
+		if _, ok := v.(string); !ok {
+			return value
+		}
+	}
+	if strings.ContainsAny(s, `"'\`) {
+		return value
+	}
+	if style == ValuesQuoteSingle {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
+}
+
+// policyPlaceholder is the value every required label and annotation is
+// scaffolded with, so that a new chart renders before it is filled in.
+const policyPlaceholder = "changeme"
+
+// policyPlaceholders returns the policy values, holding a placeholder for every required
+// label and annotation.
+func policyPlaceholders(labels, annotations []string) map[string]interface{} {
+	p := map[string]interface{}{}
+	for key, names := range map[string][]string{"labels": labels, "annotations": annotations} {
+		if len(names) == 0 {
+			continue
+		}
+		section := map[string]interface{}{}
+		for _, n := range names {
+			section[n] = policyPlaceholder
+		}
+		p[key] = section
+	}
+	return p
+}
+
+// policyValues renders the policy values of the required labels and
+// annotations as a commented section of values.yaml.
+func policyValues(labels, annotations []string) (string, error) {
+	b, err := yaml.Marshal(map[string]interface{}{"policy": policyPlaceholders(labels, annotations)})
+	if err != nil {
+		return "", errors.Wrap(err, "rendering policy values")
+	}
+	return "# Labels and annotations required on every resource by organization policy.\n" +
+		"# Replace the " + policyPlaceholder + " placeholders before installing the chart.\n" +
+		string(b), nil
+}
+
+// The body of the <CHARTNAME>.annotations helper, without and with the
+// annotations required by organization policy.
+const (
+	commonAnnotationsDefine = `{{- define "<CHARTNAME>.annotations" -}}
+{{- with .Values.commonAnnotations }}
+{{- toYaml . }}
+{{- end }}
+{{- end }}
+`
+	policyCommonAnnotationsDefine = `{{- define "<CHARTNAME>.annotations" -}}
+{{ include "<CHARTNAME>.policyAnnotations" . }}
+{{- with .Values.commonAnnotations }}
+{{ toYaml . }}
+{{- end }}
+{{- end }}
+`
+)
+
+// policyDefine renders a named template producing one line per required
+// key, taken from the policy values of the given kind.
+func policyDefine(define, kind, comment string, names []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "{{/*\n%s\n*/}}\n", comment)
+	fmt.Fprintf(&sb, "{{- define %q -}}\n", define)
+	for i, n := range names {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s: {{ index .Values.policy.%s %q | required %q | quote }}", n, kind, n, fmt.Sprintf("policy.%s.%s is required", kind, n))
+	}
+	sb.WriteString("\n{{- end }}\n")
+	return sb.String()
+}
+
+// policyHelpersName is the name of the file of the policy helpers added to a
+// chart created from a starter.
+const policyHelpersName = TemplatesDir + sep + "_policy.tpl"
+
+// Fragments of the templates of a starter that the required labels and
+// annotations are added to.
+var (
+	starterMetadata = regexp.MustCompile(`(?m)^metadata:\n`)
+	starterLabels   = regexp.MustCompile(`(?m)^( *)labels:\n( +)`)
+	// starterIfAnnotations matches the metadata annotations that are only
+	// set under a condition, such as those of the default scaffold.
+	starterIfAnnotations = regexp.MustCompile(`(?m)^  \{\{- ((?:if|with) [^\n]+?) \}\}\n  annotations:\n((?:    [^\n]*\n)+)  \{\{- end \}\}\n`)
+	starterAnnotations   = regexp.MustCompile(`(?m)^  annotations:\n`)
+)
+
+// starterPolicy adds the required labels and annotations to the chart in
+// dir, created from a starter: the policy values to values.yaml, unless the
+// starter has them already, their helpers to a template of their own, and
+// the labels to every labels key, and the annotations to the metadata, of
+// its templates.
+func starterPolicy(dir string, labels, annotations []string) error {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+	name := filepath.Base(dir)
+
+	vfile := filepath.Join(dir, ValuesfileName)
+	v, err := ioutil.ReadFile(vfile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var current map[string]interface{}
+	if err := yaml.Unmarshal(v, &current); err != nil {
+		return errors.Wrapf(err, "parsing %s", vfile)
+	}
+	if _, ok := current["policy"]; !ok {
+		p, err := policyValues(labels, annotations)
+		if err != nil {
+			return err
+		}
+		if len(v) > 0 {
+			v = append(bytes.TrimRight(v, "\n"), "\n\n"...)
+		}
+		if err := writeFile(vfile, append(v, p...)); err != nil {
+			return err
+		}
+	}
+
+	var h strings.Builder
+	if len(labels) > 0 {
+		h.WriteString(policyDefine(name+".policyLabels", "labels", "Labels required by organization policy", labels))
+	}
+	if len(annotations) > 0 {
+		if h.Len() > 0 {
+			h.WriteString("\n")
+		}
+		h.WriteString(policyDefine(name+".policyAnnotations", "annotations", "Annotations required by organization policy", annotations))
+	}
+	hfile := filepath.Join(dir, policyHelpersName)
+	if _, err := os.Stat(hfile); err == nil {
+		return errors.Errorf("cannot add the policy helpers: the starter has a %s", policyHelpersName)
+	}
+	if err := writeFile(hfile, []byte(h.String())); err != nil {
+		return err
+	}
+
+	tdir := filepath.Join(dir, TemplatesDir)
+	if _, err := os.Stat(tdir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(tdir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(p)
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), "_") || ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		src := string(b)
+		if len(labels) > 0 {
+			include := `{{- include "` + name + `.policyLabels" . | nindent %d }}`
+			if starterLabels.MatchString(src) {
+				src = starterLabels.ReplaceAllStringFunc(src, func(m string) string {
+					indent := m[strings.Index(m, "\n")+1:]
+					return m + fmt.Sprintf(include, len(indent)) + "\n" + indent
+				})
+			} else {
+				src = starterMetadata.ReplaceAllString(src, "metadata:\n  labels:\n    "+fmt.Sprintf(include, 4)+"\n")
+			}
+		}
+		if len(annotations) > 0 {
+			include := `    {{- include "` + name + `.policyAnnotations" . | nindent 4 }}` + "\n"
+			switch {
+			case starterIfAnnotations.MatchString(src):
+				// The policy annotations are never empty, so the annotations
+				// are always set and only the others are under the condition.
+				src = starterIfAnnotations.ReplaceAllStringFunc(src, func(m string) string {
+					s := starterIfAnnotations.FindStringSubmatch(m)
+					return "  annotations:\n" + include + "    {{- " + s[1] + " }}\n" + s[2] + "    {{- end }}\n"
+				})
+			case starterAnnotations.MatchString(src):
+				src = starterAnnotations.ReplaceAllLiteralString(src, "  annotations:\n"+include)
+			default:
+				src = starterMetadata.ReplaceAllLiteralString(src, "metadata:\n  annotations:\n"+include)
+			}
+		}
+		return ioutil.WriteFile(p, []byte(src), fi.Mode())
+	})
+}
+
+// Fragments of the resource templates that carry metadata.
+const (
+	metadataLabels = `  labels:
+    {{- include "<CHARTNAME>.labels" . | nindent 4 }}
+`
+	metadataAnnotations = `  {{- with include "<CHARTNAME>.annotations" . }}
+  annotations:
+    {{- . | nindent 4 }}
+  {{- end }}
+`
+	podSelectorLabels = `        {{- include "<CHARTNAME>.selectorLabels" . | nindent 8 }}
+`
+	podPolicyLabels = `        {{- include "<CHARTNAME>.policyLabels" . | nindent 8 }}
+`
+)
+
+// valuesAnnotations matches the metadata annotations block of the templates
+// that take annotations from values.
+var valuesAnnotations = regexp.MustCompile(`(?m)^  \{\{- with (\.Values\.\w+\.annotations) \}\}\n  annotations:\n    \{\{- toYaml \. \| nindent 4 \}\}\n  \{\{- end \}\}\n`)
+
+// resourceTemplate adds the required labels to the pods of src and the
+// <CHARTNAME>.annotations helper to the metadata of its resource.
+func resourceTemplate(src string, d CreateDefaults) (string, error) {
+	if len(d.RequiredLabels) > 0 {
+		src = strings.Replace(src, podSelectorLabels, podSelectorLabels+podPolicyLabels, 1)
+	}
+
+	switch {
+	case valuesAnnotations.MatchString(src):
+		return valuesAnnotations.ReplaceAllString(src, `  {{- $$annotations := include "<CHARTNAME>.annotations" . }}
+  {{- if or $1 $$annotations }}
+  annotations:
+    {{- with $1 }}
+    {{- toYaml . | nindent 4 }}
+    {{- end }}
+    {{- with $$annotations }}
+    {{- . | nindent 4 }}
+    {{- end }}
+  {{- end }}
+`), nil
+	case strings.Contains(src, metadataLabels+"  annotations:\n"):
+		// Fixed annotations, such as the test hook, are joined by ours.
+		return strings.Replace(src, metadataLabels+"  annotations:\n", metadataLabels+`  annotations:
+    {{- with include "<CHARTNAME>.annotations" . }}
+    {{- . | nindent 4 }}
+    {{- end }}
+`, 1), nil
+	default:
+		return replaceAnchors(src, metadataLabels, metadataLabels+metadataAnnotations)
+	}
+}
+
+// defaultEnvironmentValues holds the sections of a values-<env>.yaml, in the
+// same way as defaultValues. <ENVIRONMENT> is replaced by the environment.
+var defaultEnvironmentValues = []struct {
+	resource string
+	content  string
+}{
+	{"", `# Values for the <ENVIRONMENT> environment of <CHARTNAME>.
+# These override values.yaml when given after it, for example:
+#   helm install <CHARTNAME> . -f values.yaml -f values-<ENVIRONMENT>.yaml
+# Uncomment and adjust what differs in <ENVIRONMENT>.
+
+`},
+	{ScaffoldDeployment, `# replicaCount: 1
+
+# resources:
+#   limits:
+#     cpu: 100m
+#     memory: 128Mi
+#   requests:
+#     cpu: 100m
+#     memory: 128Mi
+
+`},
+	{ScaffoldIngress, `# ingress:
+#   enabled: true
+#   hosts:
+#     - host: <CHARTNAME>-<ENVIRONMENT>.example.com
+#       paths:
+#         - path: /
+#           pathType: ImplementationSpecific
+
+`},
+}
+
+// environmentValues assembles the values-<env>.yaml for env.
+func environmentValues(name, env string, want map[string]bool) []byte {
+	var sb strings.Builder
+	for _, section := range defaultEnvironmentValues {
+		if section.resource == "" || want[section.resource] {
+			sb.WriteString(section.content)
+		}
+	}
+	v := strings.ReplaceAll(strings.TrimRight(sb.String(), "\n")+"\n", "<ENVIRONMENT>", env)
+	return transform(v, name)
+}
+
+// setValue sets the value at the dotted path key of the values v to value,
+// keeping the rest of v, comments included, as it is. The lines of the
+// previous value, and the comments indented under it, are replaced.
+func setValue(v, key string, value interface{}) (string, error) {
+	lines, start, end, indent, err := findValue(v, key)
+	if err != nil {
+		return "", err
+	}
+	path := strings.Split(key, ".")
+	b, err := yaml.Marshal(map[string]interface{}{path[len(path)-1]: value})
+	if err != nil {
+		return "", errors.Wrapf(err, "rendering %s", key)
+	}
+	var sb strings.Builder
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if line != "" {
+			sb.WriteString(strings.Repeat(" ", indent) + line)
+		}
+	}
+	return strings.Join(lines[:start], "") + sb.String() + strings.Join(lines[end:], ""), nil
+}
+
+// unsetValue removes the value at the dotted path key of the values v, along
+// with the comments right above it.
+func unsetValue(v, key string) (string, error) {
+	lines, start, end, indent, err := findValue(v, key)
+	if err != nil {
+		return "", err
+	}
+	for start > 0 && strings.HasPrefix(lines[start-1], strings.Repeat(" ", indent)+"#") {
+		start--
+	}
+	// A value set apart by blank lines takes one of them along.
+	if (start == 0 || strings.TrimSpace(lines[start-1]) == "") && end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+		end++
+	}
+	return strings.Join(lines[:start], "") + strings.Join(lines[end:], ""), nil
+}
+
+// findValue returns the lines of the values v, the range of those of the
+// value at the dotted path key, and the indent of its key.
+func findValue(v, key string) (lines []string, start, end, indent int, err error) {
+	lines = strings.SplitAfter(v, "\n")
+	start, end = 0, len(lines)
+	for depth, k := range strings.Split(key, ".") {
+		if depth > 0 {
+			start++
+		}
+		// The keys of a mapping all have the indent of its first key.
+		indent = -1
+		found := -1
+		for i := start; i < end; i++ {
+			content := strings.TrimLeft(lines[i], " ")
+			if strings.TrimSpace(content) == "" || strings.HasPrefix(content, "#") {
+				continue
+			}
+			if indent < 0 {
+				indent = len(lines[i]) - len(content)
+			}
+			if len(lines[i])-len(content) == indent && (strings.HasPrefix(content, k+": ") || strings.HasPrefix(content, k+":\n")) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return nil, 0, 0, 0, errors.Errorf("values have no %s", key)
+		}
+		start, end = found, valueEnd(lines, found)
+	}
+	return lines, start, end, indent, nil
+}
+
+// valueEnd returns the index of the line after the value of the key at line
+// i: its lines are those indented further, along with the blank lines between
+// them.
+func valueEnd(lines []string, i int) int {
+	indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+	last := i
+	for j := i + 1; j < len(lines); j++ {
+		content := strings.TrimLeft(lines[j], " ")
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		if len(lines[j])-len(content) <= indent {
+			break
+		}
+		last = j
+	}
+	return last + 1
+}
+
+// yamlBlock renders value as a YAML mapping under key.
+func yamlBlock(key string, value interface{}) (string, error) {
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "rendering default %s", key)
+	}
+	var sb strings.Builder
+	sb.WriteString(key + ":\n")
+	for _, line := range strings.SplitAfter(strings.TrimRight(string(b), "\n")+"\n", "\n") {
+		if line != "" {
+			sb.WriteString("  " + line)
+		}
+	}
+	return sb.String(), nil
+}
+
+// deployment fills in the parts of the deployment template that refer to the
+// hpa, the service account, the service, the secret and the generated
+// configuration, and the container port and probes, and applies the edits of
+// the presets.
+func deployment(want map[string]bool, opts CreateOptions) (string, error) {
+	replicas := deploymentReplicas
+	if want[ScaffoldHorizontalPodAutoscaler] {
+		replicas = deploymentAutoscaledReplicas
+	}
+	var serviceAccount string
+	if want[ScaffoldServiceAccount] {
+		serviceAccount = deploymentServiceAccountName
+	}
+	port := opts.containerPort()
+	var env string
+	if opts.Secrets != "" {
+		env = deploymentSecretEnv
+	}
+	src := defaultDeployment
+	var err error
+	if handler, ok := probeHandlers[opts.Probe]; ok {
+		if src, err = replaceAnchors(src, containerHTTPProbes, "          livenessProbe:\n"+handler+"          readinessProbe:\n"+handler); err != nil {
+			return "", err
+		}
+	}
+	if want[ScaffoldService] {
+		// The container port takes the protocol of the service exposing it.
+		if src, err = replaceAnchors(src, containerProtocol, containerServiceProtocol); err != nil {
+			return "", err
+		}
+	}
+	d := fmt.Sprintf(src, replicas, serviceAccount, port, env)
+	if opts.Vault {
+		if d, err = replaceAnchors(d, deploymentMeshAnnotations, deploymentMeshAnnotations+deploymentVaultAnnotations); err != nil {
+			return "", err
+		}
+	}
+	var configs []string
+	if opts.Otel {
+		configs = append(configs, OtelConfigMapName)
+	}
+	if opts.LogSidecar {
+		configs = append(configs, LogConfigMapName)
+	}
+	var checksums string
+	if len(configs) > 0 {
+		checksums += checksumAnnotation("checksum/config", configs)
+	}
+	if opts.Secrets != "" {
+		checksums += checksumAnnotation("checksum/secret", []string{SecretName})
+	}
+	if checksums != "" {
+		if d, err = replaceAnchors(d, deploymentPodAnnotations, fmt.Sprintf(deploymentChecksumPodAnnotations, checksums)); err != nil {
+			return "", err
+		}
+	}
+	var mounts, volumes []podVolume
+	if opts.TLS {
+		if d, err = replaceAnchors(d, "          livenessProbe:\n", tlsContainerPort+"          livenessProbe:\n"); err != nil {
+			return "", err
+		}
+		d = strings.ReplaceAll(d, httpProbePort, tlsProbePort)
+		mounts = append(mounts, podVolume{".Values.tls.enabled", tlsMount})
+		volumes = append(volumes, podVolume{".Values.tls.enabled", tlsVolume})
+	}
+	if opts.Persistence {
+		mounts = append(mounts, podVolume{".Values.persistence.enabled", persistenceMount})
+		volumes = append(volumes, podVolume{".Values.persistence.enabled", persistenceVolume})
+	}
+	for _, p := range opts.presets() {
+		mounts = append(mounts, p.mounts...)
+		volumes = append(volumes, p.volumes...)
+	}
+	if opts.LogSidecar {
+		mounts = append(mounts, podVolume{".Values.logSidecar.enabled", logMount})
+	}
+	sidecars := containerVolumeMounts(mounts)
+	if opts.Otel {
+		if d, err = replaceAnchors(d, containerPorts, deploymentOtelEnv+containerPorts); err != nil {
+			return "", err
+		}
+		sidecars += deploymentOtelSidecar
+		volumes = append(volumes, podVolume{".Values.otel.enabled", otelVolume})
+	}
+	if opts.LogSidecar {
+		sidecars += deploymentLogSidecar
+		volumes = append(volumes, podVolume{".Values.logSidecar.enabled", logVolumes})
+	}
+	if d, err = replaceAnchors(d, containerResources, containerResources+sidecars+podVolumes(volumes)); err != nil {
+		return "", err
+	}
+	if opts.GPU != "" {
+		if d, err = replaceAnchors(d, podSecurityContext, podRuntimeClassName+podSecurityContext); err != nil {
+			return "", err
+		}
+	}
+	if opts.WorkloadIdentity == WorkloadIdentityAKS {
+		if d, err = replaceAnchors(d, podSelectorLabels, podSelectorLabels+podAzureWorkloadIdentity); err != nil {
+			return "", err
+		}
+	}
+	for _, p := range opts.presets() {
+		if p.deployment != nil {
+			if d, err = p.deployment(d, opts); err != nil {
+				return "", err
+			}
+		}
+	}
+	return podsTemplate(d, opts), nil
+}
+
+// podsTemplate applies the pods edits of the presets to the template src.
+func podsTemplate(src string, opts CreateOptions) string {
+	for _, p := range opts.presets() {
+		if p.pods != nil {
+			src = p.pods(src)
+		}
+	}
+	return src
+}
+
+// service returns the service template, targeting the https port of the
+// container while it serves TLS, with the edits of the presets.
+func service(opts CreateOptions) (string, error) {
+	s := defaultService
+	var err error
+	if opts.TLS {
+		if s, err = replaceAnchors(s, serviceTargetPort, tlsServiceTargetPort); err != nil {
+			return "", err
+		}
+	}
+	for _, p := range opts.presets() {
+		if p.service != nil {
+			if s, err = p.service(s, opts); err != nil {
+				return "", err
+			}
+		}
+	}
+	return s, nil
+}
+
+// notes assembles NOTES.txt from the branches of the wanted resources.
+func notes(want map[string]bool) string {
+	var sb strings.Builder
+	sb.WriteString(defaultNotes)
+	if !want[ScaffoldService] {
+		sb.WriteString(defaultNotesBranches[len(defaultNotesBranches)-1].content)
+		return sb.String()
+	}
+	keyword := "if"
+	for _, branch := range defaultNotesBranches {
+		if !want[branch.resource] {
+			continue
+		}
+		fmt.Fprintf(&sb, "{{- %s %s }}\n%s", keyword, branch.condition, branch.content)
+		keyword = "else if"
+	}
+	sb.WriteString("{{- end }}\n")
+	return sb.String()
+}
+
+// The compositions of the fully qualified app name that can be chosen with
+// CreateOptions.Fullname.
+const (
+	// FullnameReleaseChart is the release name followed by the chart name,
+	// or the release name alone when it contains the chart name.
+	FullnameReleaseChart = "release-chart"
+	// FullnameChartRelease is the chart name followed by the release name,
+	// or the release name alone when it contains the chart name.
+	FullnameChartRelease = "chart-release"
+	// FullnameChart is the chart name alone, which only allows one release
+	// of the chart in a namespace.
+	FullnameChart = "chart"
+)
+
+// FullnameFormats lists the compositions of the fully qualified app name.
+var FullnameFormats = []string{FullnameReleaseChart, FullnameChartRelease, FullnameChart}
+
+// DefaultFullnameLength is the length the fully qualified app name is
+// truncated to when CreateOptions.FullnameLength is not set.
+const DefaultFullnameLength = 63
+
+// releaseNameRoom is the length of the release names that should fit in the
+// fully qualified app name without truncating it.
+const releaseNameRoom = 20
+
+// warnNameLength warns when the fully qualified app name of the chart name,
+// composed as opts sets, is truncated for release names of releaseNameRoom
+// characters or less. Truncated names may then collide between releases
+// whose names only differ towards the end.
+func warnNameLength(name string, opts CreateOptions) {
+	length := opts.FullnameLength
+	if length == 0 {
+		length = DefaultFullnameLength
+	}
+	if opts.Fullname == FullnameChart {
+		if len(name) > length {
+			fmt.Fprintf(warningsTo(opts.Warnings), "WARNING: The chart name %q is longer than the %d characters the names of its resources are truncated to. Consider a shorter name.\n", name, length)
+		}
+		return
+	}
+	if room := length - len(name) - 1; room < releaseNameRoom {
+		if room < 0 {
+			room = 0
+		}
+		fmt.Fprintf(warningsTo(opts.Warnings), "WARNING: The names of the resources of %q are truncated to %d characters for release names longer than %d characters. Consider a shorter chart name.\n", name, length, room)
+	}
+}
+
+// fullnameHashLength is the length of the hash suffix, with its dash, of
+// names truncated by the <CHARTNAME>.truncate helper.
+const fullnameHashLength = 9
+
+// truncateHelper is the <CHARTNAME>.truncate helper, formatted with the length
+// names are truncated to and the length they are cut to before the hash
+// suffix.
+const truncateHelper = `{{/*
+Truncate a name to %[1]d chars. A longer name is cut shorter and ends with the
+first 8 chars of the sha256 hash of the whole name, so that names differing
+only past the cut do not collide.
+*/}}
+{{- define "<CHARTNAME>.truncate" -}}
+{{- if gt (len .) %[1]d }}
+{{- printf "%%s-%%s" (trunc %[2]d . | trimSuffix "-") (sha256sum . | trunc 8) }}
+{{- else }}
+{{- . }}
+{{- end }}
+{{- end }}
+
+`
+
+// fullnameHelper renders the <CHARTNAME>.fullname helper for the composition
+// and maximum length given in opts.
+func fullnameHelper(opts CreateOptions) (string, error) {
+	length := opts.FullnameLength
+	if length == 0 {
+		length = DefaultFullnameLength
+	}
+	if length < 1 || length > DefaultFullnameLength {
+		return "", errors.Errorf("fullname length must be between 1 and %d", DefaultFullnameLength)
+	}
+	trunc := fmt.Sprintf("trunc %d | trimSuffix \"-\"", length)
+	var truncHelper string
+	if opts.FullnameHash {
+		if length <= fullnameHashLength {
+			return "", errors.Errorf("fullname length must be more than %d with a hash suffix", fullnameHashLength)
+		}
+		trunc = `include "<CHARTNAME>.truncate"`
+		truncHelper = fmt.Sprintf(truncateHelper, length, length-fullnameHashLength)
+	}
+
+	var comment, body string
+	switch opts.Fullname {
+	case "", FullnameReleaseChart:
+		comment = "If release name contains chart name it will be used as a full name."
+		body = fmt.Sprintf(`{{- $name := default .Chart.Name .Values.nameOverride }}
+{{- if contains $name .Release.Name }}
+{{- .Release.Name | %[1]s }}
+{{- else }}
+{{- printf "%%s-%%s" .Release.Name $name | %[1]s }}
+{{- end }}`, trunc)
+	case FullnameChartRelease:
+		comment = "The chart name comes first. If release name contains chart name it will be used as a full name."
+		body = fmt.Sprintf(`{{- $name := default .Chart.Name .Values.nameOverride }}
+{{- if contains $name .Release.Name }}
+{{- .Release.Name | %[1]s }}
+{{- else }}
+{{- printf "%%s-%%s" $name .Release.Name | %[1]s }}
+{{- end }}`, trunc)
+	case FullnameChart:
+		comment = "The release name is left out, so only one release of the chart can be installed in a namespace."
+		body = fmt.Sprintf(`{{- default .Chart.Name .Values.nameOverride | %s }}`, trunc)
+	default:
+		return "", errors.Errorf("unknown fullname format %q, expected one of: %s", opts.Fullname, strings.Join(FullnameFormats, ", "))
+	}
+
+	reason := "We truncate at 63 chars because some Kubernetes name fields are limited to this (by the DNS naming spec)."
+	if length != DefaultFullnameLength {
+		reason = fmt.Sprintf("We truncate at %d chars to leave room for what is appended to it, such as the suffix of the jobs of a CronJob.", length)
+	}
+	if opts.FullnameHash {
+		reason += " Longer names end with a hash of the whole name, so that they stay unique."
+	}
+	return truncHelper + fmt.Sprintf(`{{/*
+Create a default fully qualified app name.
+%s
+%s
+*/}}
+{{- define "<CHARTNAME>.fullname" -}}
+{{- if .Values.fullnameOverride }}
+{{- .Values.fullnameOverride | %s }}
+{{- else }}
+%s
+{{- end }}
+{{- end }}
+`, reason, comment, trunc, body), nil
+}
+
+// helpers returns _helpers.tpl, with the service account name and service
+// mesh helpers only when those are generated, the helpers of the presets, and
+// the default labels added to the common labels.
+func helpers(name string, want map[string]bool, opts CreateOptions) ([]byte, error) {
+	d := opts.Defaults
+	fullname, err := fullnameHelper(opts)
+	if err != nil {
+		return nil, err
+	}
+	h, err := replaceAnchors(defaultHelpers, "<FULLNAME>", fullname)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Labels) > 0 {
+		labels, err := yaml.Marshal(d.Labels)
+		if err != nil {
+			return nil, errors.Wrap(err, "rendering default labels")
+		}
+		managedBy := "app.kubernetes.io/managed-by: {{ .Release.Service }}\n"
+		if h, err = replaceAnchors(h, managedBy, managedBy+string(labels)); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.RequiredLabels) > 0 {
+		managedBy := "app.kubernetes.io/managed-by: {{ .Release.Service }}\n"
+		if h, err = replaceAnchors(h, managedBy, managedBy+`{{ include "<CHARTNAME>.policyLabels" . }}`+"\n"); err != nil {
+			return nil, err
+		}
+		h += "\n" + policyDefine("<CHARTNAME>.policyLabels", "labels", "Labels required by organization policy", d.RequiredLabels)
+	}
+	if len(d.RequiredAnnotations) > 0 {
+		// The policy annotations come first so that the helper output never
+		// starts with an empty line.
+		if h, err = replaceAnchors(h, commonAnnotationsDefine, policyCommonAnnotationsDefine); err != nil {
+			return nil, err
+		}
+		h += "\n" + policyDefine("<CHARTNAME>.policyAnnotations", "annotations", "Annotations required by organization policy", d.RequiredAnnotations)
+	}
+	if want[ScaffoldServiceAccount] {
+		h += "\n" + defaultServiceAccountHelper
+	}
+	if want[ScaffoldDeployment] {
+		h += "\n" + defaultMeshHelpers
+	}
+	if opts.Vault {
+		h += "\n" + defaultVaultHelper
+	}
+	for _, p := range opts.presets() {
+		if p.helpers != "" {
+			h += "\n" + p.helpers
+		}
+	}
+	return transform(h, name), nil
+}
+
+// validateGenerated loads the chart at dir the same way install would and
+// checks its values against values.schema.json, so that a broken scaffold is
+// reported when it is generated instead of when it is first installed. The
+// chart is then checked by check, if set.
+func validateGenerated(dir string, check func(dir string) []string) error {
+	c, err := loader.Load(dir)
+	if err != nil {
+		return ErrInvalidGeneratedChart{Path: dir, Problems: []string{err.Error()}}
+	}
+
+	var problems []string
+	for _, ch := range append([]*chart.Chart{c}, c.Dependencies()...) {
+		if ch.Schema == nil {
+			continue
+		}
+		p, err := schemaProblems(ch.Values, ch.Schema)
+		if err != nil {
+			p = []string{err.Error()}
+		}
+		for _, msg := range p {
+			problems = append(problems, fmt.Sprintf("%s: %s", ch.Name(), msg))
+		}
+	}
+
+	if len(problems) == 0 && check != nil {
+		problems = check(dir)
+	}
+	if len(problems) > 0 {
+		return ErrInvalidGeneratedChart{Path: dir, Problems: problems}
+	}
+	return nil
+}
+
+// replaceAnchors replaces in turn the first occurrence of each anchor in src
+// with its replacement, given in old, new pairs as to strings.NewReplacer. The
+// anchors are fragments of the scaffold templates, and a missing one is
+// returned as ErrScaffoldAnchor instead of silently leaving out an option.
+func replaceAnchors(src string, oldnew ...string) (string, error) {
+	for i := 0; i+1 < len(oldnew); i += 2 {
+		if !strings.Contains(src, oldnew[i]) {
+			return src, ErrScaffoldAnchor{Anchor: oldnew[i]}
+		}
+		src = strings.Replace(src, oldnew[i], oldnew[i+1], 1)
+	}
+	return src, nil
+}
+
+// transform performs a string replacement of the specified source for
+// a given key with the replacement string
+func transform(src, replacement string) []byte {
+	return []byte(strings.ReplaceAll(src, "<CHARTNAME>", replacement))
+}
+
+func writeFile(name string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, content, 0644)
+}
+
+// writeSensitiveFile writes content to name so that only its owner can read
+// it. An existing file is removed first, as writing to it would keep its
+// permissions, however wide, while the content is written.
+func writeSensitiveFile(name string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(name, content, 0600)
+}
+
+// OriginalNameAnnotation is the annotation of Chart.yaml recording the name
+// a chart was asked for, before SanitizeChartName turned it into its name.
+const OriginalNameAnnotation = "helm.sh/original-name"
+
+// transliterations spell the lowercase accented Latin letters in ASCII.
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ĺ': "l", 'ľ': "l", 'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// SanitizeChartName turns name, which may be written in any script, into a
+// chart name that is also a DNS-1123 label, fit for the names of resources
+// and files. Accented Latin letters are spelled in ASCII and any other
+// characters separate words, so that "Café Crème" becomes "cafe-creme". The
+// result is truncated to 63 characters.
+//
+// A name without a letter or a digit that can be spelled in ASCII is an
+// ErrNameInvalid.
+func SanitizeChartName(name string) (string, error) {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		s, ok := transliterations[r]
+		switch {
+		case ok:
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			s = string(r)
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks, such as the accent of a decomposed "é",
+			// belong to the letter before them.
+			continue
+		default:
+			dash = sb.Len() > 0
+			continue
+		}
+		if dash {
+			sb.WriteByte('-')
+			dash = false
+		}
+		sb.WriteString(s)
+	}
+
+	s := sb.String()
+	if len(s) > 63 {
+		s = strings.TrimRight(s[:63], "-")
+	}
+	if s == "" {
+		return "", ErrNameInvalid{Kind: "chart", Name: name, Reason: "has no letter or digit that can be spelled in ASCII"}
+	}
+	return s, nil
 }
 
 func validateChartName(name string) error {
 	if name == "" || len(name) > maxChartNameLength {
-		return fmt.Errorf("chart name must be between 1 and %d characters", maxChartNameLength)
+		return ErrNameInvalid{Kind: "chart", Name: name, Reason: fmt.Sprintf("must be between 1 and %d characters", maxChartNameLength)}
 	}
 	if !chartName.MatchString(name) {
-		return fmt.Errorf("chart name must match the regular expression %q", chartName.String())
+		return ErrNameInvalid{Kind: "chart", Name: name, Reason: fmt.Sprintf("must match the regular expression %q", chartName.String())}
 	}
 	return nil
 }
@@ -0,0 +1,125 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartutil
+
+import (
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// CreateDefaultsFileName is the name of the file, in the Helm configuration
+// directory, holding the defaults for the default scaffold.
+const CreateDefaultsFileName = "create-defaults.yaml"
+
+// DefaultSpotNodeLabel is the node label of spot or preemptible node pools
+// used when CreateDefaults.SpotNodeLabel is not set.
+const DefaultSpotNodeLabel = "node.kubernetes.io/lifecycle=spot"
+
+// The amounts of comments in a generated values.yaml, set by
+// CreateDefaults.ValuesComments.
+const (
+	// ValuesCommentsFull keeps every comment. It is the default.
+	ValuesCommentsFull = "full"
+	// ValuesCommentsMinimal keeps only the comments that are not indented,
+	// which introduce the top-level keys.
+	ValuesCommentsMinimal = "minimal"
+	// ValuesCommentsNone leaves every comment out.
+	ValuesCommentsNone = "none"
+)
+
+// The quoting of the string values in a generated values.yaml, set by
+// CreateDefaults.ValuesQuote.
+const (
+	// ValuesQuoteDouble double-quotes every string value.
+	ValuesQuoteDouble = "double"
+	// ValuesQuoteSingle single-quotes every string value.
+	ValuesQuoteSingle = "single"
+)
+
+// CreateDefaults are organization-wide defaults for the default scaffold
+// generated by CreateWithOptions.
+type CreateDefaults struct {
+	// ImageRegistry is prepended to the default image repository.
+	ImageRegistry string `json:"imageRegistry,omitempty"`
+	// ImagePullPolicy replaces the default image pull policy.
+	ImagePullPolicy string `json:"imagePullPolicy,omitempty"`
+	// Resources are the default container resources.
+	Resources map[string]interface{} `json:"resources,omitempty"`
+	// Labels are added to the common labels of every generated resource.
+	Labels map[string]string `json:"labels,omitempty"`
+	// PodAnnotations are the default pod annotations.
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+	// Port is the port the container listens on and the service exposes.
+	Port int `json:"port,omitempty"`
+	// Ignore lists patterns added to every generated .helmignore.
+	Ignore []string `json:"ignore,omitempty"`
+	// RequiredLabels names labels that every generated resource and pod must
+	// carry. Their values are read from policy.labels in values.yaml, where
+	// they start out as a placeholder, and rendering fails if one of them is
+	// emptied. CreateFromOptions takes them for the other ways to create a
+	// chart.
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+	// RequiredAnnotations names annotations that every generated resource
+	// must carry, read from policy.annotations like RequiredLabels. They are
+	// rendered alongside commonAnnotations.
+	RequiredAnnotations []string `json:"requiredAnnotations,omitempty"`
+	// SpotNodeLabel is the label, as key=value, that marks the nodes of spot
+	// or preemptible node pools, and the taint keeping other workloads off
+	// them. It defaults to DefaultSpotNodeLabel.
+	SpotNodeLabel string `json:"spotNodeLabel,omitempty"`
+	// LicenseHeader is the header of every generated template unless
+	// CreateOptions.LicenseHeader is set.
+	LicenseHeader string `json:"licenseHeader,omitempty"`
+	// Home, Keywords and Maintainers are written to Chart.yaml unless the
+	// corresponding CreateOptions are set.
+	Home        string              `json:"home,omitempty"`
+	Keywords    []string            `json:"keywords,omitempty"`
+	Maintainers []*chart.Maintainer `json:"maintainers,omitempty"`
+	// ValuesIndent is the number of spaces, 2 or 4, that values.yaml is
+	// indented by. It defaults to 2.
+	ValuesIndent int `json:"valuesIndent,omitempty"`
+	// ValuesComments is the amount of comments in values.yaml, one of
+	// ValuesCommentsFull, ValuesCommentsMinimal and ValuesCommentsNone. It
+	// defaults to ValuesCommentsFull.
+	ValuesComments string `json:"valuesComments,omitempty"`
+	// ValuesQuote quotes every string value of values.yaml, in the style of
+	// ValuesQuoteDouble or ValuesQuoteSingle. By default only the strings
+	// that need quoting are quoted.
+	ValuesQuote string `json:"valuesQuote,omitempty"`
+	// TemplateIndent is the number of spaces, 2 or 4, that the generated
+	// templates are indented by. It defaults to 2.
+	TemplateIndent int `json:"templateIndent,omitempty"`
+}
+
+// LoadCreateDefaults loads a create-defaults.yaml file into a *CreateDefaults.
+//
+// Unknown keys are an error so that typos do not go unnoticed.
+func LoadCreateDefaults(filename string) (*CreateDefaults, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	d := new(CreateDefaults)
+	if err := yaml.UnmarshalStrict(b, d); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", filename)
+	}
+	return d, nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func TestLoadCreateDefaults(t *testing.T) {
+	d, err := LoadCreateDefaults("testdata/create-defaults.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ImageRegistry != "registry.example.com/" {
+		t.Errorf("Unexpected image registry %q", d.ImageRegistry)
+	}
+	if d.Port != 8080 {
+		t.Errorf("Unexpected port %d", d.Port)
+	}
+	if d.Labels["example.com/team"] != "platform" {
+		t.Errorf("Unexpected labels %v", d.Labels)
+	}
+
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+	bad := filepath.Join(tdir, CreateDefaultsFileName)
+	if err := ioutil.WriteFile(bad, []byte("imageRegistyr: typo.example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCreateDefaults(bad); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+}
+
+func TestCreateWithOptions_Defaults(t *testing.T) {
+	d, err := LoadCreateDefaults("testdata/create-defaults.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Defaults: *d})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expect := range map[string]interface{}{
+		"image.repository":        "registry.example.com/nginx",
+		"image.pullPolicy":        "Always",
+		"service.port":            float64(8080),
+		"resources.limits.memory": "128Mi",
+	} {
+		got, err := Values(mychart.Values).PathValue(path)
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if got != expect {
+			t.Errorf("%s: expected %v, got %v", path, expect, got)
+		}
+	}
+	if annotations, ok := mychart.Values["podAnnotations"].(map[string]interface{}); !ok || annotations["example.com/owner"] != "platform" {
+		t.Errorf("Unexpected pod annotations %v", mychart.Values["podAnnotations"])
+	}
+	if mychart.Metadata.Home != "https://example.com" {
+		t.Errorf("Unexpected home %q", mychart.Metadata.Home)
+	}
+	if len(mychart.Metadata.Maintainers) != 1 || mychart.Metadata.Maintainers[0].Email != "platform@example.com" {
+		t.Errorf("Unexpected maintainers %v", mychart.Metadata.Maintainers)
+	}
+
+	for _, f := range []struct {
+		name   string
+		expect string
+	}{
+		{DeploymentName, "containerPort: 8080"},
+		{HelpersName, "app.kubernetes.io/managed-by: {{ .Release.Service }}\nexample.com/team: platform\n"},
+		{IgnorefileName, "docs/\n"},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(c, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), f.expect) {
+			t.Errorf("Expected %s to contain %q", f.name, f.expect)
+		}
+	}
+}
+
+func TestCreateWithOptions_RequiredPolicy(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Defaults: CreateDefaults{
+		RequiredLabels:      []string{"team", "cost-center"},
+		RequiredAnnotations: []string{"example.com/tier"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"policy.labels.team", "policy.labels.cost-center"} {
+		if v, err := Values(mychart.Values).PathValue(path); err != nil || v != policyPlaceholder {
+			t.Errorf("Expected a placeholder for %s, got %v (%v)", path, v, err)
+		}
+	}
+
+	// Every resource template carries the policy annotations.
+	for _, f := range []string{DeploymentName, ServiceName, ServiceAccountName, IngressFileName, HorizontalPodAutoscalerName, TestConnectionName} {
+		data, err := ioutil.ReadFile(filepath.Join(c, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `include "foo.annotations" .`) {
+			t.Errorf("Expected %s to include the policy annotations", f)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `include "foo.policyLabels" . | nindent 8`) {
+		t.Error("Expected the pod template to carry the policy labels")
+	}
+}
+
+func TestCreateFromWithOptions_RequiredPolicy(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	starter, err := Create("starter", tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "foo", Version: "0.1.0"}
+	opts := CreateFromOptions{RequiredLabels: []string{"team"}, RequiredAnnotations: []string{"example.com/tier"}}
+	if err := CreateFromWithOptions(cf, tdir, starter, opts); err != nil {
+		t.Fatal(err)
+	}
+	c := filepath.Join(tdir, "foo")
+
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Values(mychart.Values).PathValue("policy.labels.team"); err != nil || v != policyPlaceholder {
+		t.Errorf("Expected a placeholder for policy.labels.team, got %v (%v)", v, err)
+	}
+	if _, err := os.Stat(filepath.Join(c, policyHelpersName)); err != nil {
+		t.Errorf("Expected the policy helpers: %s", err)
+	}
+
+	for _, f := range []struct {
+		name   string
+		expect []string
+	}{
+		{DeploymentName, []string{
+			"  labels:\n    {{- include \"foo.policyLabels\" . | nindent 4 }}\n",
+			"      labels:\n        {{- include \"foo.policyLabels\" . | nindent 8 }}\n",
+			"  annotations:\n    {{- include \"foo.policyAnnotations\" . | nindent 4 }}\n",
+		}},
+		// The annotations of the service account are no longer only set
+		// along with those of the values.
+		{ServiceAccountName, []string{
+			"  annotations:\n    {{- include \"foo.policyAnnotations\" . | nindent 4 }}\n    {{- if or .Values.serviceAccount.annotations $annotations }}\n",
+		}},
+		{TestConnectionName, []string{
+			"  annotations:\n    {{- include \"foo.policyAnnotations\" . | nindent 4 }}\n",
+		}},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(c, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expect := range f.expect {
+			if !strings.Contains(string(data), expect) {
+				t.Errorf("Expected %s to contain %q, got:\n%s", f.name, expect, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,437 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartutil
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// serverFields are the metadata fields set by the API server, and the
+// namespace, which is the one of the release, that are left out of templates.
+var serverFields = []string{"creationTimestamp", "generation", "managedFields", "namespace", "resourceVersion", "selfLink", "uid"}
+
+// serverAnnotations are the annotations set by the API server, kubectl and
+// Helm, which have no place in a template.
+var serverAnnotations = []string{
+	"deployment.kubernetes.io/revision",
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"meta.helm.sh/release-name",
+	"meta.helm.sh/release-namespace",
+}
+
+// podSpecPaths are the paths to the pod spec of the workloads whose
+// replicas and images are moved to the values.
+var podSpecPaths = map[string][]string{
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+}
+
+// nameLists are the lists whose items have names of their own, such as
+// containers and ports, which are not named after the release.
+var nameLists = map[string]bool{
+	"containers":     true,
+	"env":            true,
+	"initContainers": true,
+	"ports":          true,
+	"volumeMounts":   true,
+	"volumes":        true,
+}
+
+// valuesIdentifier matches the keys that a template can reach with a dot.
+var valuesIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// delimiterEscaper escapes the template delimiters in manifests, such as
+// those of Prometheus rules or Grafana dashboards, so that they are rendered
+// as they are.
+var delimiterEscaper = strings.NewReplacer("{{", "{{`{{`}}", "}}", "{{`}}`}}")
+
+// CreateFromManifests creates a new chart in dest from the rendered manifests
+// of the release named release, for example to take over resources that were
+// deployed with kubectl or another chart.
+//
+// Every manifest becomes a template of its own. The status, the namespace and
+// the other fields set by the API server are dropped. The name of the release
+// is replaced with {{ .Release.Name }} in the app.kubernetes.io/instance
+// labels and selectors, and in names, such as metadata.name or secretName,
+// that are the name of the release or start with it followed by a dash. The
+// replicas and container images of workloads are moved to values.yaml, under
+// a key named after the workload. The data of Secrets is not copied: it is
+// read from values.yaml, under a key named after the Secret, where it is empty,
+// and a warning is written to Stderr for each Secret. Template delimiters in
+// the manifests are escaped, so that they are rendered as they are.
+//
+// The new chart is loaded and validated once it has been written; problems
+// are reported as an ErrInvalidGeneratedChart.
+func CreateFromManifests(chartfile *chart.Metadata, dest, release string, manifests []string) error {
+	return CreateFromManifestsWithOptions(chartfile, dest, release, manifests, CreateFromOptions{})
+}
+
+// CreateFromManifestsWithOptions creates a new chart like CreateFromManifests,
+// adding the labels and annotations required by opts to the metadata of every
+// manifest and writing the warnings to opts.Warnings. The placeholders of opts
+// do not apply to manifests.
+func CreateFromManifestsWithOptions(chartfile *chart.Metadata, dest, release string, manifests []string, opts CreateFromOptions) error {
+	if err := validateChartName(chartfile.Name); err != nil {
+		return err
+	}
+
+	g := manifestTemplater{
+		release:     release,
+		values:      map[string]interface{}{},
+		labels:      opts.RequiredLabels,
+		annotations: opts.RequiredAnnotations,
+		warnings:    warningsTo(opts.Warnings),
+	}
+	if len(g.labels) > 0 || len(g.annotations) > 0 {
+		// Set first, so that a workload named policy is given another key.
+		g.values["policy"] = policyPlaceholders(g.labels, g.annotations)
+	}
+	c := &chart.Chart{
+		Metadata: chartfile,
+		Files:    []*chart.File{{Name: IgnorefileName, Data: []byte(defaultIgnore)}},
+	}
+	names := map[string]bool{}
+	for _, m := range manifests {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(m), &obj); err != nil {
+			return errors.Wrap(err, "parsing manifest")
+		}
+		kind, _ := obj["kind"].(string)
+		if kind == "" {
+			continue
+		}
+		name, data, err := g.template(kind, obj)
+		if err != nil {
+			return err
+		}
+
+		file := name
+		for i := 2; names[file]; i++ {
+			file = fmt.Sprintf("%s-%d", name, i)
+		}
+		names[file] = true
+		c.Templates = append(c.Templates, &chart.File{Name: path.Join(TemplatesDir, file+".yaml"), Data: data})
+	}
+
+	values := []byte(fmt.Sprintf("# Default values for %s, taken from the release %s.\n", chartfile.Name, release))
+	if len(g.values) > 0 {
+		b, err := yaml.Marshal(g.values)
+		if err != nil {
+			return errors.Wrap(err, "writing values file")
+		}
+		values = append(values, b...)
+	}
+	c.Raw = []*chart.File{{Name: ValuesfileName, Data: values}}
+
+	if err := SaveDir(c, dest); err != nil {
+		return err
+	}
+	return validateGenerated(filepath.Join(dest, c.Name()), opts.Check)
+}
+
+// manifestTemplater turns the manifests of a release into templates,
+// collecting the values they are given.
+type manifestTemplater struct {
+	release string
+	values  map[string]interface{}
+	// labels and annotations are those required by organization policy.
+	labels      []string
+	annotations []string
+	warnings    io.Writer
+	// exprs are the template expressions replacing the placeholders left in
+	// the current manifest, by index.
+	exprs []string
+}
+
+// template returns the file name, without extension, and the content of the
+// template of the manifest obj of the given kind.
+func (g *manifestTemplater) template(kind string, obj map[string]interface{}) (string, []byte, error) {
+	g.exprs = nil
+	delete(obj, "status")
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	for _, f := range serverFields {
+		delete(metadata, f)
+	}
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		for _, a := range serverAnnotations {
+			delete(annotations, a)
+		}
+		if len(annotations) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
+	g.chartLabels(obj)
+
+	name, _ := metadata["name"].(string)
+	if metadata != nil {
+		g.policyMetadata(metadata, true)
+	}
+	short := name
+	if name == g.release {
+		short = ""
+	} else if g.release != "" {
+		short = strings.TrimPrefix(name, g.release+"-")
+	}
+	file := strings.ToLower(kind)
+	if short != "" {
+		file = short + "-" + file
+	}
+
+	if kind == "Secret" {
+		key := g.resourceKey(short, kind)
+		if g.secretValues(key, obj) {
+			fmt.Fprintf(g.warnings, "WARNING: The data of the Secret %q is not copied to the chart. Set it under %q in values.yaml.\n", name, key)
+		}
+	}
+	if podSpec, ok := podSpecPaths[kind]; ok {
+		key := g.resourceKey(short, kind)
+		g.workloadValues(key, obj, podSpec)
+
+		// The pods carry the required labels too.
+		pod := obj
+		for _, p := range podSpec[:len(podSpec)-1] {
+			pod, _ = pod[p].(map[string]interface{})
+		}
+		if pod != nil {
+			podMetadata, _ := pod["metadata"].(map[string]interface{})
+			if podMetadata == nil {
+				podMetadata = map[string]interface{}{}
+				pod["metadata"] = podMetadata
+			}
+			g.policyMetadata(podMetadata, false)
+		}
+	}
+	if g.release != "" {
+		g.releaseNames(obj, false)
+	}
+
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "writing template of %s %s", kind, name)
+	}
+	s := delimiterEscaper.Replace(string(b))
+	for i, expr := range g.exprs {
+		s = strings.ReplaceAll(s, placeholder(i), expr)
+	}
+	return file, []byte(s), nil
+}
+
+// resourceKey returns the values key of the resource of the given kind and
+// short name, which is not yet taken by another resource.
+func (g *manifestTemplater) resourceKey(short, kind string) string {
+	key := valuesKey(short)
+	if key == "" {
+		key = valuesKey(strings.ToLower(kind))
+	}
+	if _, ok := g.values[key]; ok {
+		key += kind
+	}
+	return key
+}
+
+// secretValues replaces the data and stringData of the Secret obj with the
+// values under key, which are left empty so that no credential of the
+// cluster ends up in the chart. The data is given in values.yaml as plain
+// text, like the stringData. It reports whether the Secret had any.
+func (g *manifestTemplater) secretValues(key string, obj map[string]interface{}) bool {
+	values := map[string]interface{}{}
+	for _, field := range []string{"data", "stringData"} {
+		data, _ := obj[field].(map[string]interface{})
+		if len(data) == 0 {
+			continue
+		}
+		empty := map[string]interface{}{}
+		for k := range data {
+			empty[k] = ""
+			expr := fmt.Sprintf("index (%s) %q", valuesRef(key, field), k)
+			if field == "data" {
+				expr += " | b64enc"
+			}
+			data[k] = g.expr(expr + " | quote")
+		}
+		values[field] = empty
+	}
+	if len(values) == 0 {
+		return false
+	}
+	g.values[key] = values
+	return true
+}
+
+// workloadValues moves the replicas and the images of the containers of the
+// workload obj to the values under key.
+func (g *manifestTemplater) workloadValues(key string, obj map[string]interface{}, podSpec []string) {
+	values := map[string]interface{}{}
+	spec, _ := obj["spec"].(map[string]interface{})
+	if replicas, ok := spec["replicas"]; ok {
+		values["replicaCount"] = replicas
+		spec["replicas"] = g.expr(valuesRef(key, "replicaCount"))
+	}
+
+	pod := obj
+	for _, p := range podSpec {
+		pod, _ = pod[p].(map[string]interface{})
+	}
+	images := map[string]interface{}{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := pod[field].([]interface{})
+		for _, c := range containers {
+			container, _ := c.(map[string]interface{})
+			name, _ := container["name"].(string)
+			image, ok := container["image"].(string)
+			if !ok || valuesKey(name) == "" {
+				continue
+			}
+			images[valuesKey(name)] = image
+			container["image"] = g.expr(valuesRef(key, "image", valuesKey(name)) + " | quote")
+		}
+	}
+	if len(images) > 0 {
+		values["image"] = images
+	}
+	if len(values) > 0 {
+		g.values[key] = values
+	}
+}
+
+// policyMetadata sets the required labels, and the required annotations
+// unless only the labels apply, in metadata to their policy values.
+func (g *manifestTemplater) policyMetadata(metadata map[string]interface{}, annotate bool) {
+	for _, section := range []struct {
+		key   string
+		names []string
+	}{
+		{"labels", g.labels},
+		{"annotations", g.annotations},
+	} {
+		if len(section.names) == 0 || section.key == "annotations" && !annotate {
+			continue
+		}
+		m, _ := metadata[section.key].(map[string]interface{})
+		if m == nil {
+			m = map[string]interface{}{}
+			metadata[section.key] = m
+		}
+		for _, n := range section.names {
+			m[n] = g.expr(fmt.Sprintf("index .Values.policy.%s %q | required %q | quote", section.key, n, fmt.Sprintf("policy.%s.%s is required", section.key, n)))
+		}
+	}
+}
+
+// chartLabels templates the helm.sh/chart labels of obj, which name the chart
+// the release was installed from.
+func (g *manifestTemplater) chartLabels(obj map[string]interface{}) {
+	for k, v := range obj {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if _, ok := v["helm.sh/chart"].(string); ok && k == "labels" {
+				v["helm.sh/chart"] = g.expr(`printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 63 | trimSuffix "-" | quote`)
+			}
+			g.chartLabels(v)
+		case []interface{}:
+			for _, e := range v {
+				if m, ok := e.(map[string]interface{}); ok {
+					g.chartLabels(m)
+				}
+			}
+		}
+	}
+}
+
+// releaseNames templates the name of the release in obj where it names the
+// release: the app.kubernetes.io/instance labels and selectors, and the names
+// that are the release name or start with it. Other keys and values equal to
+// the release name, such as data, are left alone. When self is set, obj is an
+// item of a list that is named for itself, and its name is kept.
+func (g *manifestTemplater) releaseNames(obj map[string]interface{}, self bool) {
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			switch {
+			case k == "app.kubernetes.io/instance":
+				if v == g.release {
+					obj[k] = g.expr(".Release.Name")
+				}
+			case k == "name" && self:
+			case k == "name" || strings.HasSuffix(k, "Name"):
+				if v == g.release {
+					obj[k] = g.expr(".Release.Name")
+				} else if strings.HasPrefix(v, g.release+"-") {
+					obj[k] = g.expr(".Release.Name") + strings.TrimPrefix(v, g.release)
+				}
+			}
+		case map[string]interface{}:
+			if k != "annotations" && k != "data" && k != "stringData" {
+				g.releaseNames(v, false)
+			}
+		case []interface{}:
+			for _, e := range v {
+				if m, ok := e.(map[string]interface{}); ok {
+					g.releaseNames(m, nameLists[k])
+				}
+			}
+		}
+	}
+}
+
+// expr returns a placeholder for the template expression expr.
+func (g *manifestTemplater) expr(expr string) string {
+	g.exprs = append(g.exprs, "{{ "+expr+" }}")
+	return placeholder(len(g.exprs) - 1)
+}
+
+func placeholder(i int) string {
+	return fmt.Sprintf("__TEMPLATE_EXPR_%d__", i)
+}
+
+// valuesKey turns the name of a resource or container into a camel-cased
+// values key, such as "webApi" for "web-api".
+func valuesKey(name string) string {
+	var sb strings.Builder
+	for i, w := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if i > 0 {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		sb.WriteString(w)
+	}
+	return sb.String()
+}
+
+// valuesRef returns the template expression reaching the value at keys.
+func valuesRef(keys ...string) string {
+	for _, k := range keys {
+		if !valuesIdentifier.MatchString(k) {
+			return `index .Values "` + strings.Join(keys, `" "`) + `"`
+		}
+	}
+	return ".Values." + strings.Join(keys, ".")
+}
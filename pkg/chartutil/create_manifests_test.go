@@ -0,0 +1,333 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+const releaseDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: juno-web
+  namespace: prod
+  uid: 6d1b9c3e-0f6a-4b9e-9a43-1c2d3e4f5a6b
+  labels:
+    app.kubernetes.io/instance: juno
+    helm.sh/chart: legacy-1.0.0
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app.kubernetes.io/instance: juno
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/instance: juno
+    spec:
+      containers:
+        - name: web-server
+          image: nginx:1.21
+status:
+  readyReplicas: 3
+`
+
+const releaseService = `apiVersion: v1
+kind: Service
+metadata:
+  name: juno
+spec:
+  selector:
+    app.kubernetes.io/instance: juno
+  ports:
+    - port: 80
+`
+
+func TestCreateFromManifests(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	if err := CreateFromManifests(cf, tdir, "juno", []string{releaseDeployment, releaseService}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loader.LoadDir(filepath.Join(tdir, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, ok := c.Values["web"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected values for the web deployment, got %v", c.Values)
+	}
+	if web["replicaCount"] != 3.0 {
+		t.Errorf("Expected replicaCount 3, got %v", web["replicaCount"])
+	}
+	if image := web["image"].(map[string]interface{})["webServer"]; image != "nginx:1.21" {
+		t.Errorf("Expected image nginx:1.21, got %v", image)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, "web-deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := string(b)
+	for _, expect := range []string{
+		"name: {{ .Release.Name }}-web\n",
+		"app.kubernetes.io/instance: {{ .Release.Name }}\n",
+		"helm.sh/chart: {{ printf \"%s-%s\" .Chart.Name .Chart.Version",
+		"replicas: {{ .Values.web.replicaCount }}\n",
+		"image: {{ .Values.web.image.webServer | quote }}\n",
+	} {
+		if !strings.Contains(deployment, expect) {
+			t.Errorf("Expected %q in the deployment, got:\n%s", expect, deployment)
+		}
+	}
+	for _, unexpected := range []string{"namespace:", "uid:", "status:"} {
+		if strings.Contains(deployment, unexpected) {
+			t.Errorf("Expected no %q in the deployment, got:\n%s", unexpected, deployment)
+		}
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, "service.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "name: {{ .Release.Name }}\n") {
+		t.Errorf("Expected the service to be named after the release, got:\n%s", b)
+	}
+}
+
+func TestCreateFromManifestsWithOptions_RequiredPolicy(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	opts := CreateFromOptions{RequiredLabels: []string{"team"}, RequiredAnnotations: []string{"example.com/tier"}}
+	if err := CreateFromManifestsWithOptions(cf, tdir, "juno", []string{releaseDeployment, releaseService}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loader.LoadDir(filepath.Join(tdir, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Values(c.Values).PathValue("policy.labels.team"); err != nil || v != policyPlaceholder {
+		t.Errorf("Expected a placeholder for policy.labels.team, got %v (%v)", v, err)
+	}
+	if annotations, err := Values(c.Values).Table("policy.annotations"); err != nil || annotations["example.com/tier"] != policyPlaceholder {
+		t.Errorf("Expected a placeholder for the tier annotation, got %v (%v)", annotations, err)
+	}
+
+	label := `team: {{ index .Values.policy.labels "team" | required "policy.labels.team is required" | quote }}` + "\n"
+	annotation := `example.com/tier: {{ index .Values.policy.annotations "example.com/tier" | required "policy.annotations.example.com/tier is required" | quote }}` + "\n"
+	for _, f := range []struct {
+		name        string
+		labels      int
+		annotations int
+	}{
+		// The deployment and its pods carry the labels.
+		{"web-deployment.yaml", 2, 1},
+		{"service.yaml", 1, 1},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(b), label); n != f.labels {
+			t.Errorf("Expected the team label %d times in %s, got %d:\n%s", f.labels, f.name, n, b)
+		}
+		if n := strings.Count(string(b), annotation); n != f.annotations {
+			t.Errorf("Expected the tier annotation %d times in %s, got %d:\n%s", f.annotations, f.name, n, b)
+		}
+	}
+}
+
+func TestCreateFromManifests_ReleaseNameInData(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	configMap := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-settings
+  labels:
+    app.kubernetes.io/instance: web
+data:
+  web: enabled
+  mode: web
+  url: http://web-api:8080
+`
+	secret := `apiVersion: v1
+kind: Secret
+metadata:
+  name: web
+stringData:
+  web-token: web
+`
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	if err := CreateFromManifests(cf, tdir, "web", []string{configMap, secret}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, "settings-configmap.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"name: {{ .Release.Name }}-settings\n",
+		"app.kubernetes.io/instance: {{ .Release.Name }}\n",
+		"  web: enabled\n",
+		"  mode: web\n",
+		"  url: http://web-api:8080\n",
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in the config map, got:\n%s", expect, b)
+		}
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, "secret.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"name: {{ .Release.Name }}\n", "  web-token: {{ index (.Values.secret.stringData) \"web-token\" | quote }}\n"} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in the secret, got:\n%s", expect, b)
+		}
+	}
+}
+
+func TestCreateFromManifests_SecretData(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	secret := `apiVersion: v1
+kind: Secret
+metadata:
+  name: juno-db
+type: Opaque
+data:
+  password: aHVudGVyMg==
+stringData:
+  username: admin
+`
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	var warnings bytes.Buffer
+	if err := CreateFromManifestsWithOptions(cf, tdir, "juno", []string{secret}, CreateFromOptions{Warnings: &warnings}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warnings.String(), `"juno-db" is not copied`) {
+		t.Errorf("Expected a warning about the data of the Secret, got %q", warnings.String())
+	}
+
+	c, err := loader.LoadDir(filepath.Join(tdir, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"db.data.password", "db.stringData.username"} {
+		if v, err := Values(c.Values).PathValue(path); err != nil || v != "" {
+			t.Errorf("Expected %s to be empty, got %v (%v)", path, v, err)
+		}
+	}
+	for _, f := range append(c.Templates, c.Raw...) {
+		for _, leaked := range []string{"aHVudGVyMg==", "admin"} {
+			if strings.Contains(string(f.Data), leaked) {
+				t.Errorf("Expected no %q in %s, got:\n%s", leaked, f.Name, f.Data)
+			}
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, "db-secret.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "password: {{ index (.Values.db.data) \"password\" | b64enc | quote }}\n") {
+		t.Errorf("Expected the password to be read from the values, got:\n%s", b)
+	}
+}
+
+func TestCreateFromManifests_Delimiters(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	configMap := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: juno-rules
+data:
+  rules.yaml: |
+    summary: Instance {{ $labels.instance }} is down
+`
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	if err := CreateFromManifests(cf, tdir, "juno", []string{configMap}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(tdir, "foo", TemplatesDir, "rules-configmap.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"summary: Instance {{`{{`}} $labels.instance {{`}}`}} is down\n",
+		"name: {{ .Release.Name }}-rules\n",
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in the config map, got:\n%s", expect, b)
+		}
+	}
+}
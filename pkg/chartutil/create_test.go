@@ -18,9 +18,13 @@ package chartutil
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"helm.sh/helm/v3/pkg/chart"
@@ -69,6 +73,1471 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreateWithOptions_Metadata(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Description: "Foo", Version: "2.0.0", AppVersion: "3.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, ChartfileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"\ndescription: Foo\n",
+		"\nversion: 2.0.0\n",
+		"\nappVersion: \"3.1\"\n",
+		"# This is the chart version.",
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in %s", expect, ChartfileName)
+		}
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{APIVersion: "v3"}); err == nil {
+		t.Error("Expected an error for an unknown API version")
+	}
+}
+
+func TestCreateWithOptions_LicenseHeader(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	header := "SPDX-License-Identifier: Apache-2.0"
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{LicenseHeader: header, Otel: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{DeploymentName, HelpersName, NotesName, OtelConfigMapName, TestConnectionName} {
+		b, err := ioutil.ReadFile(filepath.Join(c, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(b), "{{- /*\n"+header+"\n*/ -}}\n") {
+			t.Errorf("Expected %s to start with the license header", f)
+		}
+	}
+	for _, f := range []string{ChartfileName, ValuesfileName} {
+		b, err := ioutil.ReadFile(filepath.Join(c, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), header) {
+			t.Errorf("Expected no license header in %s", f)
+		}
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{LicenseHeader: "*/"}); err == nil {
+		t.Error("Expected an error for a header closing the comment")
+	}
+}
+
+func TestCreateWithOptions_ArtifactHub(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{
+		ArtifactHub:   true,
+		LicenseHeader: "SPDX-License-Identifier: MIT",
+		Home:          "https://example.com",
+		AppVersion:    "2.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expect := range map[string]string{
+		"artifacthub.io/license": "MIT",
+		"artifacthub.io/links":   "- name: Homepage\n  url: https://example.com\n",
+		"artifacthub.io/images":  "- name: foo\n  image: nginx:2.0.0\n",
+		"artifacthub.io/changes": "- kind: added\n  description: Initial release\n",
+	} {
+		if got := mychart.Metadata.Annotations[key]; got != expect {
+			t.Errorf("%s: expected %q, got %q", key, expect, got)
+		}
+	}
+
+	c, err = CreateWithOptions("bar", tdir, CreateOptions{ArtifactHub: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err = loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mychart.Metadata.Annotations["artifacthub.io/license"]; ok {
+		t.Error("Expected the license to be left as a comment without an SPDX license header")
+	}
+}
+
+func TestCreateWithOptions_Dependencies(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Dependencies: []*chart.Dependency{
+		{Name: "postgresql", Version: "12.x", Repository: "https://charts.bitnami.com/bitnami"},
+		{Name: "redis", Version: "~17.0.0", Repository: "@bitnami", Alias: "cache"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := mychart.Metadata.Dependencies
+	if len(deps) != 2 {
+		t.Fatalf("Expected 2 dependencies, got %d", len(deps))
+	}
+	for i, expect := range []string{"postgresql.enabled", "cache.enabled"} {
+		if deps[i].Condition != expect {
+			t.Errorf("Expected condition %q, got %q", expect, deps[i].Condition)
+		}
+		if enabled, err := Values(mychart.Values).PathValue(expect); err != nil || enabled != true {
+			t.Errorf("Expected %s to be true in values, got %v", expect, enabled)
+		}
+	}
+
+	for _, deps := range [][]*chart.Dependency{
+		{{Name: "pg sql", Repository: "@bitnami"}},
+		{{Name: "postgresql", Version: "twelve", Repository: "@bitnami"}},
+		{{Name: "service", Repository: "@bitnami"}},
+		{{Name: "redis", Repository: "@bitnami"}, {Name: "redis", Repository: "@other"}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, CreateOptions{Dependencies: deps}); err == nil {
+			t.Errorf("Expected an error for dependencies %v", deps)
+		}
+	}
+
+	// Only the top-level keys of the values conflict, not nested ones or
+	// those in comments, and all of them do, including the policy values.
+	nested := []*chart.Dependency{{Name: "port", Repository: "@bitnami"}, {Name: "limits", Repository: "@bitnami"}}
+	if _, err := CreateWithOptions("baz", tdir, CreateOptions{Dependencies: nested}); err != nil {
+		t.Errorf("Expected no conflict with nested keys, got %v", err)
+	}
+	policy := []*chart.Dependency{{Name: "policy", Repository: "@bitnami"}}
+	if _, err := CreateWithOptions("qux", tdir, CreateOptions{Dependencies: policy, Defaults: CreateDefaults{RequiredLabels: []string{"team"}}}); !errors.As(err, &ErrDependencyValuesConflict{}) {
+		t.Errorf("Expected an ErrDependencyValuesConflict for the policy values, got %v", err)
+	}
+}
+
+func TestCreateWithOptions_Fullname(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	for _, tt := range []struct {
+		opts   CreateOptions
+		expect string
+	}{
+		{CreateOptions{}, `{{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" }}`},
+		{CreateOptions{Fullname: FullnameChartRelease}, `{{- printf "%s-%s" $name .Release.Name | trunc 63 | trimSuffix "-" }}`},
+		{CreateOptions{Fullname: FullnameChart, FullnameLength: 52}, `{{- default .Chart.Name .Values.nameOverride | trunc 52 | trimSuffix "-" }}`},
+	} {
+		c, err := CreateWithOptions("foo", tdir, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(c, HelpersName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tt.expect) {
+			t.Errorf("%s: expected %q in %s", tt.opts.Fullname, tt.expect, HelpersName)
+		}
+	}
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{FullnameHash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, HelpersName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		`{{- printf "%s-%s" (trunc 54 . | trimSuffix "-") (sha256sum . | trunc 8) }}`,
+		`{{- printf "%s-%s" .Release.Name $name | include "foo.truncate" }}`,
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in %s", expect, HelpersName)
+		}
+	}
+
+	for _, opts := range []CreateOptions{
+		{Fullname: "release"},
+		{FullnameLength: 64},
+		{FullnameLength: -1},
+		{FullnameLength: 9, FullnameHash: true},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_ValuesStyle(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	for _, tt := range []struct {
+		defaults CreateDefaults
+		expect   []string
+		unexpect []string
+	}{
+		{
+			CreateDefaults{ValuesIndent: 4},
+			[]string{"image:\n    repository: nginx\n", "    # Overrides the image tag"},
+			nil,
+		},
+		{
+			CreateDefaults{ValuesComments: ValuesCommentsMinimal},
+			[]string{"# Default values for foo.\n", "image:\n  repository: nginx\n  pullPolicy: IfNotPresent\n  tag: \"\"\n"},
+			[]string{"  # Overrides the image tag"},
+		},
+		{
+			CreateDefaults{ValuesComments: ValuesCommentsNone},
+			[]string{"replicaCount: 1\n\nstrategy:\n"},
+			[]string{"#"},
+		},
+		{
+			CreateDefaults{ValuesQuote: ValuesQuoteDouble},
+			[]string{"replicaCount: 1\n", "  repository: \"nginx\"\n", "  tag: \"\"\n", "  create: true\n", "    - host: \"chart-example.local\"\n"},
+			nil,
+		},
+		{
+			CreateDefaults{ValuesQuote: ValuesQuoteSingle, ValuesIndent: 4},
+			[]string{"image:\n    repository: 'nginx'\n", "    tag: ''\n", "    # Overrides the image tag"},
+			[]string{`: ""`},
+		},
+	} {
+		c, err := CreateWithOptions("foo", tdir, CreateOptions{Defaults: tt.defaults})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(c, ValuesfileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expect := range tt.expect {
+			if !strings.Contains(string(b), expect) {
+				t.Errorf("%+v: expected %q in %s, got:\n%s", tt.defaults, expect, ValuesfileName, b)
+			}
+		}
+		for _, unexpected := range tt.unexpect {
+			if strings.Contains(string(b), unexpected) {
+				t.Errorf("%+v: expected no %q in %s, got:\n%s", tt.defaults, unexpected, ValuesfileName, b)
+			}
+		}
+	}
+
+	for _, d := range []CreateDefaults{{ValuesIndent: 3}, {ValuesComments: "some"}, {ValuesQuote: "back"}, {TemplateIndent: 3}} {
+		if _, err := CreateWithOptions("bar", tdir, CreateOptions{Defaults: d}); err == nil {
+			t.Errorf("Expected an error for %+v", d)
+		}
+	}
+}
+
+func TestCreateWithOptions_TemplateIndent(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Defaults: CreateDefaults{TemplateIndent: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"metadata:\n    name: {{ include \"foo.fullname\" . }}\n    labels:\n        {{- include \"foo.labels\" . | nindent 8 }}\n",
+		"                {{- toYaml .Values.resources | nindent 24 }}\n",
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in %s, got:\n%s", expect, DeploymentName, b)
+		}
+	}
+}
+
+func TestCreateWithOptions_Errors(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	if _, err := CreateWithOptions("foo bar", tdir, CreateOptions{}); !errors.As(err, &ErrNameInvalid{}) {
+		t.Errorf("Expected an ErrNameInvalid, got %v", err)
+	}
+	if _, err := CreateWithOptions("foo", tdir, CreateOptions{Environments: []string{"prod env"}}); !errors.As(err, &ErrNameInvalid{}) {
+		t.Errorf("Expected an ErrNameInvalid, got %v", err)
+	}
+	if _, err := CreateWithOptions("foo", tdir, CreateOptions{Skip: []string{"cronjob"}}); !errors.As(err, &ErrUnknownScaffoldResource{}) {
+		t.Errorf("Expected an ErrUnknownScaffoldResource, got %v", err)
+	}
+	deps := []*chart.Dependency{{Name: "service", Repository: "@bitnami"}}
+	if _, err := CreateWithOptions("foo", tdir, CreateOptions{Dependencies: deps}); !errors.As(err, &ErrDependencyValuesConflict{}) {
+		t.Errorf("Expected an ErrDependencyValuesConflict, got %v", err)
+	}
+
+	cf := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "foo", Version: "0.1.0"}
+	if err := CreateFrom(cf, tdir, filepath.Join(tdir, "missing")); !errors.As(err, &ErrChartNotFound{}) {
+		t.Errorf("Expected an ErrChartNotFound, got %v", err)
+	}
+}
+
+func TestCreateWithOptions_WarnsNameLength(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	var errlog bytes.Buffer
+	long := strings.Repeat("a", 45)
+	for _, tt := range []struct {
+		name   string
+		opts   CreateOptions
+		expect string
+	}{
+		{"foo", CreateOptions{}, ""},
+		{long, CreateOptions{}, "for release names longer than 17 characters"},
+		{"foo", CreateOptions{FullnameLength: 20}, "for release names longer than 16 characters"},
+		{long, CreateOptions{Fullname: FullnameChart}, ""},
+		{long, CreateOptions{Fullname: FullnameChart, FullnameLength: 40}, "longer than the 40 characters"},
+	} {
+		errlog.Reset()
+		opts := tt.opts
+		opts.Warnings = &errlog
+		if _, err := CreateWithOptions(tt.name, tdir, opts); err != nil {
+			t.Fatal(err)
+		}
+		if tt.expect == "" && strings.Contains(errlog.String(), "truncated") {
+			t.Errorf("%s %+v: expected no warning, got %q", tt.name, tt.opts, errlog.String())
+		}
+		if tt.expect != "" && !strings.Contains(errlog.String(), tt.expect) {
+			t.Errorf("%s %+v: expected a warning with %q, got %q", tt.name, tt.opts, tt.expect, errlog.String())
+		}
+	}
+}
+
+func TestCreateWithOptions_Skip(t *testing.T) {
+	for _, tt := range []struct {
+		skip      []string
+		absent    []string
+		noValues  []string
+		withValue []string
+	}{
+		{
+			skip:      []string{ScaffoldIngress, ScaffoldHorizontalPodAutoscaler, ScaffoldServiceAccount, ScaffoldTests},
+			absent:    []string{IngressFileName, HorizontalPodAutoscalerName, ServiceAccountName, TestConnectionName},
+			noValues:  []string{"ingress", "autoscaling", "serviceAccount"},
+			withValue: []string{"service", "image", "nameOverride"},
+		},
+		{
+			skip:      []string{ScaffoldService, ScaffoldIngress, ScaffoldTests},
+			absent:    []string{ServiceName, IngressFileName, TestConnectionName},
+			noValues:  []string{"service", "ingress"},
+			withValue: []string{"serviceAccount", "autoscaling", "image"},
+		},
+		{
+			skip:      ScaffoldResources,
+			absent:    []string{DeploymentName, NotesName, ServiceName, IngressFileName, ServiceAccountName, HorizontalPodAutoscalerName, TestConnectionName},
+			noValues:  []string{"image", "replicaCount", "service", "ingress", "serviceAccount", "autoscaling", "affinity"},
+			withValue: []string{"nameOverride", "fullnameOverride"},
+		},
+	} {
+		tdir, err := ioutil.TempDir("", "helm-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tdir)
+
+		c, err := CreateWithOptions("foo", tdir, CreateOptions{Skip: tt.skip})
+		if err != nil {
+			t.Fatalf("skip %v: %s", tt.skip, err)
+		}
+
+		for _, f := range tt.absent {
+			if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+				t.Errorf("skip %v: expected %s to be absent", tt.skip, f)
+			}
+		}
+
+		mychart, err := loader.LoadDir(c)
+		if err != nil {
+			t.Fatalf("skip %v: %s", tt.skip, err)
+		}
+		for _, k := range tt.noValues {
+			if _, ok := mychart.Values[k]; ok {
+				t.Errorf("skip %v: expected no %q in values", tt.skip, k)
+			}
+		}
+		for _, k := range tt.withValue {
+			if _, ok := mychart.Values[k]; !ok {
+				t.Errorf("skip %v: expected %q in values", tt.skip, k)
+			}
+		}
+	}
+}
+
+func TestCreateWithOptions_SkipErrors(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	for _, skip := range [][]string{
+		{"bogus"},
+		{ScaffoldService},
+		{ScaffoldDeployment},
+	} {
+		if _, err := CreateWithOptions("foo", tdir, CreateOptions{Skip: skip}); err == nil {
+			t.Errorf("expected an error skipping %v", skip)
+		}
+	}
+}
+
+func TestCreateWithOptions_Only(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Only: []string{ScaffoldDeployment, ScaffoldService}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{DeploymentName, ServiceName, NotesName, HelpersName, ValuesfileName} {
+		if _, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s file: %s", f, err)
+		}
+	}
+	for _, f := range []string{IngressFileName, ServiceAccountName, HorizontalPodAutoscalerName, TestConnectionName} {
+		if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be absent", f)
+		}
+	}
+
+	for _, opts := range []CreateOptions{
+		{Only: []string{ScaffoldIngress}},
+		{Only: []string{"bogus"}},
+		{Only: []string{ScaffoldDeployment}, Skip: []string{ScaffoldTests}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_Ignore(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Ignore: []string{"docs/", "*.md"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c, IgnorefileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(defaultIgnore)) {
+		t.Error("Expected the default patterns to be kept")
+	}
+	if !bytes.HasSuffix(data, []byte("docs/\n*.md\n")) {
+		t.Errorf("Expected the additional patterns at the end, got:\n%s", data)
+	}
+
+	// The new patterns are honored when the chart is loaded.
+	if err := writeFile(filepath.Join(c, "docs", "guide.txt"), []byte("guide")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(c, "README.md"), []byte("readme")); err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range mychart.Files {
+		if f.Name == "README.md" || strings.HasPrefix(f.Name, "docs/") {
+			t.Errorf("Expected %s to be ignored", f.Name)
+		}
+	}
+
+	for _, pattern := range []string{"docs/**", "a\nb", "[z-a"} {
+		if _, err := CreateWithOptions("bar", tdir, CreateOptions{Ignore: []string{pattern}}); err == nil {
+			t.Errorf("Expected an error for pattern %q", pattern)
+		}
+	}
+}
+
+func TestCreateWithOptions_Environments(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{
+		Environments: []string{"dev", "prod"},
+		Skip:         []string{ScaffoldIngress},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{"dev", "prod"} {
+		data, err := ioutil.ReadFile(filepath.Join(c, "values-"+env+".yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte("-f values-"+env+".yaml")) {
+			t.Errorf("Expected values-%s.yaml to explain how it is used", env)
+		}
+		if !bytes.Contains(data, []byte("# replicaCount: 1")) {
+			t.Errorf("Expected values-%s.yaml to suggest a replica count", env)
+		}
+		if bytes.Contains(data, []byte("ingress")) {
+			t.Errorf("Expected no ingress overrides in values-%s.yaml when the ingress is skipped", env)
+		}
+		if bytes.Contains(data, []byte("<")) {
+			t.Errorf("Expected all placeholders in values-%s.yaml to be replaced", env)
+		}
+	}
+
+	for _, envs := range [][]string{{"dev", "dev"}, {"my env"}} {
+		if _, err := CreateWithOptions("bar", tdir, CreateOptions{Environments: envs}); err == nil {
+			t.Errorf("Expected an error for environments %v", envs)
+		}
+	}
+}
+
+func TestCreateWithOptions_Secrets(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	// A secrets.yaml readable by everyone is replaced by one that is not.
+	if err := writeFile(filepath.Join(tdir, "foo", SecretsValuesfileName), []byte("secrets: {}\n")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Secrets: SecretsProviderSops})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only secrets.yaml holds the sensitive values, the Secret template
+	// refers to them.
+	for f, mode := range map[string]os.FileMode{SecretName: 0644, SecretsValuesfileName: 0600} {
+		if info, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s file: %s", f, err)
+		} else if runtime.GOOS != "windows" && info.Mode().Perm() != mode {
+			t.Errorf("Expected %s to have %o mode but has %o", f, mode, info.Mode().Perm())
+		}
+	}
+
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := mychart.Values["secrets"].(map[string]interface{}); !ok || len(v) != 0 {
+		t.Errorf("Expected empty secrets in values.yaml, got %v", mychart.Values["secrets"])
+	}
+	for _, f := range mychart.Files {
+		if f.Name == SecretsValuesfileName {
+			t.Errorf("Expected %s to be excluded by .helmignore", f.Name)
+		}
+	}
+
+	secrets, err := ReadValuesFile(filepath.Join(c, SecretsValuesfileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secrets.Table("secrets"); err != nil {
+		t.Errorf("Expected a secrets table in %s: %s", SecretsValuesfileName, err)
+	}
+
+	for _, opts := range []CreateOptions{
+		{Secrets: "vault"},
+		{Secrets: SecretsProviderSops, Skip: ScaffoldResources},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_Vault(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{
+		Vault:    true,
+		Defaults: CreateDefaults{PodAnnotations: map[string]string{"example.com/owner": "platform"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations, err := Values(mychart.Values).Table("podAnnotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := annotations["example.com/owner"]; got != "platform" {
+		t.Errorf("Expected pod annotation example.com/owner to be platform, got %v", got)
+	}
+	if _, ok := annotations["vault.hashicorp.com/agent-inject"]; ok {
+		t.Error("Expected no Vault annotations in podAnnotations")
+	}
+	for path, expect := range map[string]interface{}{
+		"vault.enabled":        false,
+		"vault.role":           "foo",
+		"vault.secrets.config": "secret/data/foo/config",
+	} {
+		if got, err := Values(mychart.Values).PathValue(path); err != nil || got != expect {
+			t.Errorf("Expected %s to be %v, got %v (%v)", path, expect, got, err)
+		}
+	}
+}
+
+func TestCreateWithOptions_PullSecret(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetPullSecret}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, PullSecretName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", PullSecretName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Values(mychart.Values).Table("imageCredentials"); err != nil {
+		t.Errorf("Expected imageCredentials in values: %s", err)
+	}
+
+	// The credentials are kept in a file of their own, which only its owner
+	// can read and which is not packaged.
+	for f, mode := range map[string]os.FileMode{PullSecretName: 0644, CredentialsValuesfileName: 0600} {
+		if info, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s file: %s", f, err)
+		} else if runtime.GOOS != "windows" && info.Mode().Perm() != mode {
+			t.Errorf("Expected %s to have %o mode but has %o", f, mode, info.Mode().Perm())
+		}
+	}
+	for _, f := range mychart.Files {
+		if f.Name == CredentialsValuesfileName {
+			t.Errorf("Expected %s to be ignored", CredentialsValuesfileName)
+		}
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Presets: []string{PresetPullSecret}, Only: []string{ScaffoldService}}); err == nil {
+		t.Error("Expected an error generating a pull secret without a deployment")
+	}
+}
+
+func TestCreateWithOptions_PodMonitor(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetPodMonitor}, Only: []string{ScaffoldDeployment}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, PodMonitorName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", PodMonitorName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, err := Values(mychart.Values).PathValue("podMonitor.port"); err != nil || port != "http" {
+		t.Errorf("Expected podMonitor.port to be http, got %v (%v)", port, err)
+	}
+}
+
+func TestCreateWithOptions_Operator(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetOperator}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{RBACName, WebhookName, CRDsReadmeName} {
+		if _, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s to be generated: %s", f, err)
+		}
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mychart.CRDObjects()) != 0 {
+		t.Errorf("Expected no CRDs, got %d", len(mychart.CRDObjects()))
+	}
+	if port, err := Values(mychart.Values).PathValue("webhook.port"); err != nil || port != 9443.0 {
+		t.Errorf("Expected webhook.port to be 9443, got %v (%v)", port, err)
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Presets: []string{PresetOperator}, Skip: []string{ScaffoldServiceAccount}}); err == nil {
+		t.Error("Expected an error without a service account")
+	}
+	if _, err := CreateWithOptions("baz", tdir, CreateOptions{Presets: []string{"controller"}}); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+}
+
+func TestCreateWithOptions_HookJob(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{
+		Presets:  []string{PresetHookJob},
+		Only:     []string{ScaffoldServiceAccount},
+		Defaults: CreateDefaults{RequiredLabels: []string{"team"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, HookJobName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"app.kubernetes.io/name: {{ include \"foo.name\" . }}-hook\n",
+		"        {{- include \"foo.policyLabels\" . | nindent 8 }}\n",
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in %s", expect, HookJobName)
+		}
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phase, err := Values(mychart.Values).PathValue("hookJob.phase"); err != nil || phase != "post-install,post-upgrade" {
+		t.Errorf("Expected hookJob.phase to be post-install,post-upgrade, got %v (%v)", phase, err)
+	}
+}
+
+func TestCreateWithOptions_Migration(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetMigration}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, MigrationJobName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", MigrationJobName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deadline, err := Values(mychart.Values).PathValue("migration.activeDeadlineSeconds"); err != nil || deadline != 300.0 {
+		t.Errorf("Expected migration.activeDeadlineSeconds to be 300, got %v (%v)", deadline, err)
+	}
+	if _, err := Values(mychart.Values).PathValue("env"); err != nil {
+		t.Errorf("Expected env to be shared with the migration: %s", err)
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Presets: []string{PresetMigration}, Only: []string{ScaffoldServiceAccount}}); err == nil {
+		t.Error("Expected an error without a deployment")
+	}
+}
+
+func TestCreateWithOptions_Canary(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetCanary}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, CanaryIngressName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", CanaryIngressName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weight, err := Values(mychart.Values).PathValue("canary.weight"); err != nil || weight != 10.0 {
+		t.Errorf("Expected canary.weight to be 10, got %v (%v)", weight, err)
+	}
+
+	for _, opts := range []CreateOptions{
+		{Presets: []string{PresetCanary}, Skip: []string{ScaffoldIngress}},
+		{Presets: []string{PresetCanary, PresetBlueGreen}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_BlueGreen(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetBlueGreen}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, HorizontalPodAutoscalerName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no %s, got %v", HorizontalPodAutoscalerName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, err := Values(mychart.Values).PathValue("blueGreen.active"); err != nil || active != "blue" {
+		t.Errorf("Expected blueGreen.active to be blue, got %v (%v)", active, err)
+	}
+
+	for _, opts := range []CreateOptions{
+		{Presets: []string{PresetBlueGreen}, Only: []string{ScaffoldDeployment}},
+		{Presets: []string{PresetBlueGreen}, Only: []string{ScaffoldDeployment, ScaffoldService, ScaffoldHorizontalPodAutoscaler}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for only %v", opts.Only)
+		}
+	}
+}
+
+func TestCreateWithOptions_WebApp(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetWebApp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expect := range map[string]interface{}{
+		"ingress.enabled":        true,
+		"autoscaling.enabled":    true,
+		"resources.requests.cpu": "100m",
+		"service.port":           80.0,
+	} {
+		if got, err := Values(mychart.Values).PathValue(key); err != nil || got != expect {
+			t.Errorf("Expected %s to be %v, got %v (%v)", key, expect, got, err)
+		}
+	}
+
+	for _, opts := range []CreateOptions{
+		{Presets: []string{PresetWebApp}, Skip: []string{ScaffoldHorizontalPodAutoscaler}},
+		{Presets: []string{PresetWebApp, PresetBlueGreen}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_Worker(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetWorker}, Defaults: CreateDefaults{Port: 8080}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{ServiceName, IngressFileName, TestConnectionName} {
+		if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s, got %v", f, err)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unexpected := range []string{"ports:", "containerPort", "httpGet"} {
+		if strings.Contains(string(b), unexpected) {
+			t.Errorf("Expected no %q in %s", unexpected, DeploymentName)
+		}
+	}
+	b, err = ioutil.ReadFile(filepath.Join(c, NotesName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "port-forward") {
+		t.Errorf("Expected %s to leave out the port-forward", NotesName)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grace, err := Values(mychart.Values).PathValue("terminationGracePeriodSeconds"); err != nil || grace != 60.0 {
+		t.Errorf("Expected terminationGracePeriodSeconds to be 60, got %v (%v)", grace, err)
+	}
+
+	for _, opts := range []CreateOptions{
+		{Presets: []string{PresetWorker}, TLS: true},
+		{Presets: []string{PresetWorker}, Probe: ProbeTCP},
+		{Presets: []string{PresetWorker, PresetOperator}},
+		{Presets: []string{PresetWorker, PresetPodMonitor}},
+		{Presets: []string{PresetWorker, PresetBlueGreen}},
+		{Presets: []string{PresetWorker}, Only: []string{ScaffoldDeployment, ScaffoldService}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_Cron(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetCron}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{CronJobName, CronConfigMapName, NotesName, ServiceAccountName} {
+		if _, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s to be generated: %s", f, err)
+		}
+	}
+	for _, f := range []string{DeploymentName, ServiceName, IngressFileName, HorizontalPodAutoscalerName, TestConnectionName} {
+		if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s, got %v", f, err)
+		}
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule, err := Values(mychart.Values).PathValue("cron.schedule"); err != nil || schedule != "0 * * * *" {
+		t.Errorf("Expected cron.schedule to be 0 * * * *, got %v (%v)", schedule, err)
+	}
+	if _, err := Values(mychart.Values).Table("image"); err == nil {
+		t.Error("Expected no image values of the deployment")
+	}
+
+	for _, opts := range []CreateOptions{
+		{Presets: []string{PresetCron}, Only: []string{ScaffoldDeployment, ScaffoldServiceAccount}},
+		{Presets: []string{PresetCron}, Skip: []string{ScaffoldServiceAccount}},
+		{Presets: []string{PresetCron}, Otel: true},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_Stateful(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetStateful}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{DeploymentName, HorizontalPodAutoscalerName} {
+		if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s, got %v", f, err)
+		}
+	}
+	for _, f := range []string{StatefulSetName, HeadlessServiceName} {
+		if _, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s to be generated: %s", f, err)
+		}
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := Values(mychart.Values).PathValue("volumeClaim.size"); err != nil || size != "8Gi" {
+		t.Errorf("Expected volumeClaim.size to be 8Gi, got %v (%v)", size, err)
+	}
+	for _, key := range []string{"strategy", "progressDeadlineSeconds"} {
+		if _, ok := mychart.Values[key]; ok {
+			t.Errorf("Expected no %s in values", key)
+		}
+	}
+
+	for _, opts := range []CreateOptions{
+		{Presets: []string{PresetStateful}, Persistence: true},
+		{Presets: []string{PresetStateful, PresetCanary}},
+		{Presets: []string{PresetStateful}, Skip: []string{ScaffoldService, ScaffoldIngress, ScaffoldTests}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestCreateWithOptions_Consumer(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{PresetConsumer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{ServiceName, HorizontalPodAutoscalerName} {
+		if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s, got %v", f, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c, ScaledObjectName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", ScaledObjectName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The values of the worker preset come along.
+	for _, key := range []string{"keda.trigger.type", "terminationGracePeriodSeconds"} {
+		if _, err := Values(mychart.Values).PathValue(key); err != nil {
+			t.Errorf("Expected %s in values: %s", key, err)
+		}
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Presets: []string{PresetConsumer}, TLS: true}); err == nil {
+		t.Error("Expected the checks of the worker preset to apply")
+	}
+}
+
+func TestCreateWithOptions_PresetDefinition(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	def := &PresetDefinition{
+		Name:      "acme",
+		Resources: []string{ScaffoldDeployment, ScaffoldService, ScaffoldServiceAccount},
+		Presets:   []string{PresetPullSecret},
+		Values:    map[string]interface{}{"service.port": 8080},
+		Files:     map[string]string{DeploymentName: "templates/api.yaml"},
+	}
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Presets: []string{"acme"}, PresetDefinitions: []*PresetDefinition{def}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{DeploymentName, IngressFileName, HorizontalPodAutoscalerName} {
+		if _, err := os.Stat(filepath.Join(c, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s, got %v", f, err)
+		}
+	}
+	for _, f := range []string{"templates/api.yaml", ServiceName, PullSecretName} {
+		if _, err := os.Stat(filepath.Join(c, f)); err != nil {
+			t.Errorf("Expected %s to be generated: %s", f, err)
+		}
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, err := Values(mychart.Values).PathValue("service.port"); err != nil || port != 8080.0 {
+		t.Errorf("Expected service.port to be 8080, got %v (%v)", port, err)
+	}
+
+	def.Files = map[string]string{"templates/nothing.yaml": "templates/api.yaml"}
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Presets: []string{"acme"}, PresetDefinitions: []*PresetDefinition{def}}); err == nil {
+		t.Error("Expected an error renaming a file the scaffold does not have")
+	}
+}
+
+func TestLoadPresetDefinition(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	tests := []struct {
+		content string
+		err     bool
+	}{
+		{"name: acme\nresources: [deployment, service]\npresets: [pullsecret]\nvalues:\n  service.port: 8080\n", false},
+		{"name: acme\nresource: [deployment]\n", true},
+		{"name: worker\n", true},
+		{"name: Acme!\n", true},
+		{"name: acme\nresources: [database]\n", true},
+		{"name: acme\nfiles:\n  templates/deployment.yaml: ../api.yaml\n", true},
+		{"name: acme\nfiles:\n  templates/deployment.yaml: /api.yaml\n", true},
+	}
+	for i, tt := range tests {
+		filename := filepath.Join(tdir, fmt.Sprintf("preset-%d.yaml", i))
+		if err := ioutil.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		def, err := LoadPresetDefinition(filename)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Expected an error loading %q", tt.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to load %q: %s", tt.content, err)
+			continue
+		}
+		if def.Name != "acme" || len(def.Resources) != 2 || def.Values["service.port"] != 8080.0 {
+			t.Errorf("Unexpected definition %+v", def)
+		}
+	}
+}
+
+func TestCreateWithOptions_Otel(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Otel: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, OtelConfigMapName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", OtelConfigMapName, err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled, err := Values(mychart.Values).PathValue("otel.enabled"); err != nil || enabled != false {
+		t.Errorf("Expected otel.enabled to be false, got %v (%v)", enabled, err)
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Otel: true, Skip: []string{ScaffoldDeployment, ScaffoldService, ScaffoldIngress, ScaffoldHorizontalPodAutoscaler, ScaffoldTests}}); err == nil {
+		t.Error("Expected an error adding a sidecar without a deployment")
+	}
+}
+
+func TestCreateWithOptions_LogSidecar(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{LogSidecar: true, Otel: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, LogConfigMapName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", LogConfigMapName, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "      volumes:\n"); n != 1 {
+		t.Errorf("Expected the sidecars to share one volumes block, got %d", n)
+	}
+}
+
+func TestCreateWithOptions_ConfigChecksum(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "checksum/") {
+		t.Error("Expected no checksum annotations without generated configuration")
+	}
+
+	c, err = CreateWithOptions("bar", tdir, CreateOptions{Otel: true, LogSidecar: true, Secrets: SecretsProviderSops})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		`checksum/config: {{ print (include (print $.Template.BasePath "/otel-configmap.yaml") .) (include (print $.Template.BasePath "/fluent-bit-configmap.yaml") .) | sha256sum }}`,
+		`checksum/secret: {{ include (print $.Template.BasePath "/secret.yaml") . | sha256sum }}`,
+	} {
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in the deployment", expect)
+		}
+	}
+}
+
+func TestCreateWithOptions_Persistence(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Persistence: true, LogSidecar: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c, PersistentVolumeClaimName)); err != nil {
+		t.Errorf("Expected %s to be generated: %s", PersistentVolumeClaimName, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "          volumeMounts:\n"); n != 1 {
+		t.Errorf("Expected the application container to have one volumeMounts block, got %d", n)
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Persistence: true, Only: []string{ScaffoldServiceAccount}}); err == nil {
+		t.Error("Expected an error for persistence without a deployment")
+	}
+}
+
+func TestCreateWithOptions_Arch(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Arch: "arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, err := Values(mychart.Values).Table("nodeSelector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := selector["kubernetes.io/arch"]; got != "arm64" {
+		t.Errorf("Expected node selector kubernetes.io/arch to be arm64, got %v", got)
+	}
+	tolerations, ok := mychart.Values["tolerations"].([]interface{})
+	if !ok || len(tolerations) != 1 {
+		t.Fatalf("Expected one toleration, got %v", mychart.Values["tolerations"])
+	}
+	if got := tolerations[0].(map[string]interface{})["value"]; got != "arm64" {
+		t.Errorf("Expected the toleration value to be arm64, got %v", got)
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{Arch: "sparc"}); err == nil {
+		t.Error("Expected an error for an unknown architecture")
+	}
+}
+
+func TestCreateWithOptions_GPU(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{
+		GPU:      GPUNvidia,
+		Arch:     "amd64",
+		Defaults: CreateDefaults{Resources: map[string]interface{}{"limits": map[string]interface{}{"memory": "1Gi"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := Values(mychart.Values).Table("resources.limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["memory"] != "1Gi" || limits["nvidia.com/gpu"] != float64(1) {
+		t.Errorf("Expected the default limits and one GPU, got %v", limits)
+	}
+	if got := mychart.Values["runtimeClassName"]; got != "nvidia" {
+		t.Errorf("Expected runtimeClassName to be nvidia, got %v", got)
+	}
+	if tolerations, ok := mychart.Values["tolerations"].([]interface{}); !ok || len(tolerations) != 2 {
+		t.Errorf("Expected the architecture and GPU tolerations, got %v", mychart.Values["tolerations"])
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{GPU: "amd"}); err == nil {
+		t.Error("Expected an error for an unknown GPU vendor")
+	}
+}
+
+func TestCreateWithOptions_Spot(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{
+		Spot:     true,
+		Defaults: CreateDefaults{SpotNodeLabel: "cloud.google.com/gke-spot=true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mychart, err := loader.LoadDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tolerations, ok := mychart.Values["tolerations"].([]interface{})
+	if !ok || len(tolerations) != 1 {
+		t.Fatalf("Expected one toleration, got %v", mychart.Values["tolerations"])
+	}
+	toleration := tolerations[0].(map[string]interface{})
+	if toleration["key"] != "cloud.google.com/gke-spot" || toleration["value"] != "true" {
+		t.Errorf("Expected a toleration of the spot node taint, got %v", toleration)
+	}
+	if _, err := Values(mychart.Values).Table("affinity.nodeAffinity"); err != nil {
+		t.Errorf("Expected a node affinity for spot nodes: %s", err)
+	}
+
+	if _, err := CreateWithOptions("bar", tdir, CreateOptions{
+		Spot:     true,
+		Defaults: CreateDefaults{SpotNodeLabel: "spot"},
+	}); err == nil {
+		t.Error("Expected an error for a spot node label without a value")
+	}
+}
+
+func TestCreateWithOptions_WorkloadIdentity(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	for provider, annotation := range map[string]string{
+		WorkloadIdentityGKE: "# iam.gke.io/gcp-service-account: gke@PROJECT_ID.iam.gserviceaccount.com",
+		WorkloadIdentityEKS: "# eks.amazonaws.com/role-arn: arn:aws:iam::ACCOUNT_ID:role/eks",
+		WorkloadIdentityAKS: "# azure.workload.identity/client-id: CLIENT_ID",
+	} {
+		c, err := CreateWithOptions(provider, tdir, CreateOptions{WorkloadIdentity: provider})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(c, ValuesfileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte(annotation)) {
+			t.Errorf("Expected %s values to contain %q", provider, annotation)
+		}
+
+		deployment, err := ioutil.ReadFile(filepath.Join(c, DeploymentName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasLabel := bytes.Contains(deployment, []byte("azure.workload.identity/use")); hasLabel != (provider == WorkloadIdentityAKS) {
+			t.Errorf("Unexpected azure.workload.identity/use pod label for %s", provider)
+		}
+	}
+
+	for _, opts := range []CreateOptions{
+		{WorkloadIdentity: "openstack"},
+		{WorkloadIdentity: WorkloadIdentityGKE, Skip: []string{ScaffoldServiceAccount}},
+	} {
+		if _, err := CreateWithOptions("bar", tdir, opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
 func TestCreateFrom(t *testing.T) {
 	tdir, err := ioutil.TempDir("", "helm-")
 	if err != nil {
@@ -118,6 +1587,294 @@ func TestCreateFrom(t *testing.T) {
 	}
 }
 
+func TestCreateFrom_WarnsIgnored(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	var errlog bytes.Buffer
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV1,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	if err := CreateFromWithOptions(cf, tdir, "./testdata/frobnitz", CreateFromOptions{Warnings: &errlog}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(errlog.String(), `"ignore/"`) {
+		t.Errorf("Expected a warning about the ignored directory, got %q", errlog.String())
+	}
+	if _, err := os.Stat(filepath.Join(tdir, "foo", "ignore")); !os.IsNotExist(err) {
+		t.Error("Expected the ignored directory not to be copied")
+	}
+}
+
+func TestCreateFrom_InvalidSchema(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	err = CreateFrom(cf, tdir, "./testdata/starter-schema-violation")
+
+	var invalid ErrInvalidGeneratedChart
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected ErrInvalidGeneratedChart, got %v", err)
+	}
+	if len(invalid.Problems) != 1 {
+		t.Fatalf("expected 1 problem, got %v", invalid.Problems)
+	}
+	if !strings.Contains(invalid.Problems[0], "replicaCount") {
+		t.Errorf("expected problem to mention replicaCount, got %q", invalid.Problems[0])
+	}
+}
+
+func TestCreateWithOptions_Check(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	var checked string
+	check := func(dir string) []string {
+		checked = dir
+		return []string{"templates/service.yaml: Service \"foo\" is also rendered by templates/other.yaml"}
+	}
+	c, err := CreateWithOptions("foo", tdir, CreateOptions{Check: check})
+	var invalid ErrInvalidGeneratedChart
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected ErrInvalidGeneratedChart, got %v", err)
+	}
+	if checked != c {
+		t.Errorf("Expected %s to be checked, got %q", c, checked)
+	}
+	if len(invalid.Problems) != 1 || !strings.Contains(invalid.Problems[0], "also rendered by") {
+		t.Errorf("Expected the problem of the check, got %v", invalid.Problems)
+	}
+}
+
+func TestCreateFromWithOptions_Placeholders(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	opts := CreateFromOptions{Placeholders: map[string]string{"<MODULE_NAME>": "api"}}
+	if err := CreateFromWithOptions(cf, tdir, "./testdata/starter-placeholders", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for f, expect := range map[string]string{
+		ValuesfileName: "api:\n  image: foo-api\n",
+		filepath.Join(TemplatesDir, "configmap.yaml"): "{{ .Values.api.image }}",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(tdir, "foo", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), expect) {
+			t.Errorf("Expected %q in %s, got:\n%s", expect, f, b)
+		}
+	}
+
+	for _, placeholders := range []map[string]string{{"": "api"}, {"<CHARTNAME>": "bar"}, {"<MODULE\nNAME>": "api"}} {
+		opts := CreateFromOptions{Placeholders: placeholders}
+		if err := CreateFromWithOptions(cf, tdir, "./testdata/starter-placeholders", opts); err == nil {
+			t.Errorf("Expected an error for placeholders %v", placeholders)
+		}
+	}
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	r, err := CreateFromOptions{Placeholders: map[string]string{"<MODULE_NAME>": "api"}}.replacer("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sniffed start of the file ends in the middle of the "é".
+	long := strings.Repeat("#", binarySniffLen-1) + "é\n"
+	for data, expect := range map[string]string{
+		"name: <CHARTNAME>-<MODULE_NAME>\n": "name: foo-api\n",
+		"a: <CHARTNAME>\nb: <MODULE_NAME>":  "a: foo\nb: api",
+		"\x00<CHARTNAME>":                   "\x00<CHARTNAME>",
+		"\xff<CHARTNAME>":                   "\xff<CHARTNAME>",
+		long + "name: <CHARTNAME>\n":        long + "name: foo\n",
+	} {
+		var b bytes.Buffer
+		if err := replacePlaceholders(r, &b, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != expect {
+			t.Errorf("%q: expected %q, got %q", data, expect, got)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	v := `# The image.
+image:
+  repository: nginx
+  # The tag.
+  tag: ""
+
+resources: {}
+  # limits:
+  #   cpu: 100m
+
+nodeSelector: {}
+`
+	for _, tt := range []struct {
+		key    string
+		value  interface{}
+		expect string
+	}{
+		{"image.tag", "1.0", strings.Replace(v, `tag: ""`, `tag: "1.0"`, 1)},
+		{"resources", map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}},
+			strings.Replace(v, "resources: {}\n  # limits:\n  #   cpu: 100m\n", "resources:\n  limits:\n    cpu: \"1\"\n", 1)},
+		{"nodeSelector", map[string]interface{}{}, v},
+	} {
+		got, err := setValue(v, tt.key, tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expect {
+			t.Errorf("%s: expected %q, got %q", tt.key, tt.expect, got)
+		}
+	}
+	for _, key := range []string{"tag", "image.digest", "resources.limits"} {
+		if _, err := setValue(v, key, "x"); err == nil {
+			t.Errorf("Expected an error setting %s", key)
+		}
+	}
+}
+
+func TestUnsetValue(t *testing.T) {
+	v := "replicaCount: 1\n\n# The strategy.\nstrategy:\n  type: RollingUpdate\n\nimage:\n  repository: nginx\n  # The tag.\n  tag: \"\"\n"
+	for key, expect := range map[string]string{
+		"strategy":  "replicaCount: 1\n\nimage:\n  repository: nginx\n  # The tag.\n  tag: \"\"\n",
+		"image.tag": "replicaCount: 1\n\n# The strategy.\nstrategy:\n  type: RollingUpdate\n\nimage:\n  repository: nginx\n",
+	} {
+		got, err := unsetValue(v, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expect {
+			t.Errorf("%s: expected %q, got %q", key, expect, got)
+		}
+	}
+	if _, err := unsetValue(v, "image.digest"); err == nil {
+		t.Error("Expected an error unsetting image.digest")
+	}
+}
+
+func TestCreate_Reproducible(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	first, err := Create("foo", tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seconddir := filepath.Join(tdir, "second")
+	if err := os.Mkdir(seconddir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	second, err := Create("foo", seconddir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSameTree(t, first, second)
+}
+
+func TestCreateFrom_Reproducible(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	cf := &chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       "foo",
+		Version:    "0.1.0",
+	}
+	// mariner has a subchart, which is copied along.
+	srcdir := "./testdata/frobnitz/charts/mariner"
+
+	var dirs []string
+	for _, d := range []string{"first", "second"} {
+		dest := filepath.Join(tdir, d)
+		if err := os.Mkdir(dest, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateFrom(cf, dest, srcdir); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, filepath.Join(dest, cf.Name))
+	}
+
+	assertSameTree(t, dirs[0], dirs[1])
+}
+
+// assertSameTree fails the test unless both directories contain the same
+// relative paths with byte-identical contents.
+func assertSameTree(t *testing.T, a, b string) {
+	t.Helper()
+	read := func(root string) map[string][]byte {
+		files := map[string][]byte{}
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			files[rel] = data
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	af, bf := read(a), read(b)
+	if len(af) != len(bf) {
+		t.Fatalf("expected %d files, got %d", len(af), len(bf))
+	}
+	for name, data := range af {
+		other, ok := bf[name]
+		if !ok {
+			t.Errorf("file %s missing from second run", name)
+			continue
+		}
+		if !bytes.Equal(data, other) {
+			t.Errorf("file %s differs between runs", name)
+		}
+	}
+}
+
 // TestCreate_Overwrite is a regression test for making sure that files are overwritten.
 func TestCreate_Overwrite(t *testing.T) {
 	tdir, err := ioutil.TempDir("", "helm-")
@@ -157,6 +1914,52 @@ func TestCreate_Overwrite(t *testing.T) {
 	}
 }
 
+func TestSanitizeChartName(t *testing.T) {
+	for name, expect := range map[string]string{
+		"Café Crème":            "cafe-creme",
+		"Straße_Ölçer":          "strasse-olcer",
+		"Cafe\u0301":            "cafe",
+		"日本 app 2":              "app-2",
+		strings.Repeat("é", 70): strings.Repeat("e", 63),
+	} {
+		got, err := SanitizeChartName(name)
+		if err != nil {
+			t.Errorf("%q: %s", name, err)
+		} else if got != expect {
+			t.Errorf("%q: expected %q, got %q", name, expect, got)
+		}
+	}
+
+	if _, err := SanitizeChartName("日本"); !errors.As(err, &ErrNameInvalid{}) {
+		t.Errorf("Expected an ErrNameInvalid, got %v", err)
+	}
+}
+
+func TestCreateWithOptions_OriginalName(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "helm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	for _, opts := range []CreateOptions{{OriginalName: "Café"}, {OriginalName: "Café", ArtifactHub: true}} {
+		c, err := CreateWithOptions("cafe", tdir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, err := loader.LoadDir(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := ch.Metadata.Annotations[OriginalNameAnnotation]; name != "Café" {
+			t.Errorf("%+v: expected the original name Café, got %q", opts, name)
+		}
+		if opts.ArtifactHub && ch.Metadata.Annotations["artifacthub.io/changes"] == "" {
+			t.Errorf("Expected the Artifact Hub annotations to be kept, got %v", ch.Metadata.Annotations)
+		}
+	}
+}
+
 func TestValidateChartName(t *testing.T) {
 	for name, shouldPass := range map[string]bool{
 		"":                              false,
@@ -183,3 +1986,22 @@ func TestValidateChartName(t *testing.T) {
 		}
 	}
 }
+
+func TestReplaceAnchors(t *testing.T) {
+	got, err := replaceAnchors("a: 1\nb: 2\n", "a: 1\n", "a: 3\n", "b: 2\n", "b: 4\nc: 5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "a: 3\nb: 4\nc: 5\n"; got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+
+	// The edits of a preset to a template lacking their anchors are an
+	// error, not a panic.
+	var anchor ErrScaffoldAnchor
+	if _, err := scaffoldPresets[PresetCanary].deployment("kind: Deployment\n", CreateOptions{}); !errors.As(err, &anchor) {
+		t.Errorf("Expected ErrScaffoldAnchor, got %v", err)
+	} else if anchor.Anchor != deploymentName {
+		t.Errorf("Expected the missing anchor %q, got %q", deploymentName, anchor.Anchor)
+	}
+}
@@ -18,6 +18,7 @@ package chartutil
 
 import (
 	"fmt"
+	"strings"
 )
 
 // ErrNoTable indicates that a chart does not have a matching table.
@@ -33,3 +34,65 @@ type ErrNoValue struct {
 }
 
 func (e ErrNoValue) Error() string { return fmt.Sprintf("%q is not a value", e.Key) }
+
+// ErrInvalidGeneratedChart indicates that a chart written by Create or
+// CreateFrom does not load or does not satisfy its own schema.
+type ErrInvalidGeneratedChart struct {
+	Path     string
+	Problems []string
+}
+
+func (e ErrInvalidGeneratedChart) Error() string {
+	return fmt.Sprintf("generated chart %s is invalid:\n- %s", e.Path, strings.Join(e.Problems, "\n- "))
+}
+
+// ErrNameInvalid indicates that the name of a chart, or of an environment or
+// dependency of a generated chart, is not valid.
+type ErrNameInvalid struct {
+	// Kind is what is named: "chart", "environment" or "dependency".
+	Kind   string
+	Name   string
+	Reason string
+}
+
+func (e ErrNameInvalid) Error() string {
+	return fmt.Sprintf("%s name %q %s", e.Kind, e.Name, e.Reason)
+}
+
+// ErrChartNotFound indicates that the chart to scaffold from does not exist.
+type ErrChartNotFound struct {
+	Path string
+}
+
+func (e ErrChartNotFound) Error() string { return fmt.Sprintf("chart %s not found", e.Path) }
+
+// ErrUnknownScaffoldResource indicates that a resource given to
+// CreateOptions.Skip or CreateOptions.Only is not one of ScaffoldResources.
+type ErrUnknownScaffoldResource struct {
+	Resource string
+}
+
+func (e ErrUnknownScaffoldResource) Error() string {
+	return fmt.Sprintf("unknown scaffold resource %q, expected one of: %s", e.Resource, strings.Join(ScaffoldResources, ", "))
+}
+
+// ErrDependencyValuesConflict indicates that the values of a dependency would
+// replace a top-level key that the values of the chart already have.
+type ErrDependencyValuesConflict struct {
+	// Key is the name, or alias, of the dependency.
+	Key string
+}
+
+func (e ErrDependencyValuesConflict) Error() string {
+	return fmt.Sprintf("the values of dependency %q would replace the %s values of the chart", e.Key, e.Key)
+}
+
+// ErrScaffoldAnchor indicates that a template of the scaffold lacks the
+// fragment that an option or a preset edits, so that it cannot be applied.
+type ErrScaffoldAnchor struct {
+	Anchor string
+}
+
+func (e ErrScaffoldAnchor) Error() string {
+	return fmt.Sprintf("scaffold template has no %q to edit", e.Anchor)
+}
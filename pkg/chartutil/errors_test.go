@@ -35,3 +35,10 @@ func TestErrorNoValueDoesNotPanic(t *testing.T) {
 
 	t.Logf("error is: %s", y)
 }
+
+func TestErrNameInvalid(t *testing.T) {
+	err := ErrNameInvalid{Kind: "chart", Name: "foo bar", Reason: "must not contain spaces"}
+	if expect := `chart name "foo bar" must not contain spaces`; err.Error() != expect {
+		t.Errorf("Expected %q, got %q", expect, err.Error())
+	}
+}
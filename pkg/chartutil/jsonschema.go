@@ -56,13 +56,31 @@ func ValidateAgainstSchema(chrt *chart.Chart, values map[string]interface{}) err
 
 // ValidateAgainstSingleSchema checks that values does not violate the structure laid out in this schema
 func ValidateAgainstSingleSchema(values Values, schemaJSON []byte) error {
-	valuesData, err := yaml.Marshal(values)
+	problems, err := schemaProblems(values, schemaJSON)
 	if err != nil {
 		return err
 	}
+
+	if len(problems) > 0 {
+		var sb strings.Builder
+		for _, p := range problems {
+			sb.WriteString(fmt.Sprintf("- %s\n", p))
+		}
+		return errors.New(sb.String())
+	}
+
+	return nil
+}
+
+// schemaProblems returns one description per violation of schemaJSON by values.
+func schemaProblems(values Values, schemaJSON []byte) ([]string, error) {
+	valuesData, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
 	valuesJSON, err := yaml.YAMLToJSON(valuesData)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if bytes.Equal(valuesJSON, []byte("null")) {
 		valuesJSON = []byte("{}")
@@ -72,16 +90,12 @@ func ValidateAgainstSingleSchema(values Values, schemaJSON []byte) error {
 
 	result, err := gojsonschema.Validate(schemaLoader, valuesLoader)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !result.Valid() {
-		var sb strings.Builder
-		for _, desc := range result.Errors() {
-			sb.WriteString(fmt.Sprintf("- %s\n", desc))
-		}
-		return errors.New(sb.String())
+	var problems []string
+	for _, desc := range result.Errors() {
+		problems = append(problems, desc.String())
 	}
-
-	return nil
+	return problems, nil
 }
@@ -101,7 +101,9 @@ func Templates(linter *support.Linter, values map[string]interface{}, namespace
 	- {{}} include | quote
 	- Generated content is a valid Yaml file
 	- Metadata.Namespace is not set
+	- No two resources share an API group, kind, namespace and name
 	*/
+	resources := map[string]string{}
 	for _, template := range chart.Templates {
 		fileName, data := template.Name, template.Data
 		fpath = fileName
@@ -153,6 +155,7 @@ func Templates(linter *support.Linter, values map[string]interface{}, namespace
 
 					linter.RunLinterRule(support.ErrorSev, fpath, validateMatchSelector(yamlStruct, renderedContent))
 					linter.RunLinterRule(support.ErrorSev, fpath, validateListAnnotations(yamlStruct, renderedContent))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateUniqueResource(yamlStruct, fpath, namespace, resources))
 				}
 			}
 		}
@@ -323,6 +326,44 @@ func validateListAnnotations(yamlStruct *K8sYamlStruct, manifest string) error {
 	return nil
 }
 
+// validateUniqueResource ensures that no other template renders a resource of
+// the same API group and kind, in the same namespace and with the same name,
+// which would fail the install. Resources without a namespace are installed
+// in the release namespace. resources maps the resources seen so far to their
+// templates.
+func validateUniqueResource(yamlStruct *K8sYamlStruct, fpath, releaseNamespace string, resources map[string]string) error {
+	if yamlStruct.Kind == "" || yamlStruct.Kind == "List" || yamlStruct.Metadata.Name == "" {
+		return nil
+	}
+	var group string
+	if i := strings.LastIndex(yamlStruct.APIVersion, "/"); i >= 0 {
+		group = yamlStruct.APIVersion[:i]
+	}
+	ns := yamlStruct.Metadata.Namespace
+	if ns == "" {
+		ns = releaseNamespace
+	}
+	key := strings.Join([]string{group, yamlStruct.Kind, ns, yamlStruct.Metadata.Name}, "/")
+	if other, ok := resources[key]; ok {
+		return ErrDuplicateResource{Kind: yamlStruct.Kind, Name: yamlStruct.Metadata.Name, Template: other}
+	}
+	resources[key] = fpath
+	return nil
+}
+
+// ErrDuplicateResource indicates that a template renders a resource that
+// another template renders already.
+type ErrDuplicateResource struct {
+	Kind string
+	Name string
+	// Template is the template that renders the resource first.
+	Template string
+}
+
+func (e ErrDuplicateResource) Error() string {
+	return fmt.Sprintf("%s %q is also rendered by %s", e.Kind, e.Name, e.Template)
+}
+
 // K8sYamlStruct stubs a Kubernetes YAML file.
 //
 // DEPRECATED: In Helm 4, this will be made a private type, as it is for use only within
@@ -424,6 +424,60 @@ func TestEmptyWithCommentsManifests(t *testing.T) {
 		t.Fatalf("Expected 0 lint errors, got %d", l)
 	}
 }
+
+func TestDuplicateResourcesFail(t *testing.T) {
+	mychart := chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: "v2",
+			Name:       "duplicates",
+			Version:    "0.1.0",
+			Icon:       "satisfy-the-linting-gods.gif",
+		},
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}-config\n"),
+			},
+			{
+				Name: "templates/other.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}-config\n---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: {{ .Release.Name }}-config\n"),
+			},
+			{
+				// The same kind in another API group is another resource.
+				Name: "templates/issuers.yaml",
+				Data: []byte("apiVersion: cert-manager.io/v1\nkind: Issuer\nmetadata:\n  name: issuer\n---\napiVersion: example.com/v1\nkind: Issuer\nmetadata:\n  name: issuer\n"),
+			},
+			{
+				// A resource without a namespace is installed in the release
+				// namespace.
+				Name: "templates/service.yaml",
+				Data: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  namespace: {{ .Release.Namespace }}\n"),
+			},
+		},
+	}
+	tmpdir := ensure.TempDir(t)
+	defer os.RemoveAll(tmpdir)
+
+	if err := chartutil.SaveDir(&mychart, tmpdir); err != nil {
+		t.Fatal(err)
+	}
+
+	linter := support.Linter{ChartDir: filepath.Join(tmpdir, mychart.Name())}
+	Templates(&linter, values, namespace, strict)
+	if l := len(linter.Messages); l != 2 {
+		for i, msg := range linter.Messages {
+			t.Logf("Message %d: %s", i, msg)
+		}
+		t.Fatalf("Expected 2 lint errors, got %d", l)
+	}
+	if msg := linter.Messages[0]; msg.Path != "templates/other.yaml" || !strings.Contains(msg.Err.Error(), "templates/configmap.yaml") {
+		t.Errorf("Expected the duplicate in templates/other.yaml to be reported, got %s", msg)
+	}
+	if msg := linter.Messages[1]; msg.Path != "templates/service.yaml" || !strings.Contains(msg.Err.Error(), `Service "web"`) {
+		t.Errorf("Expected the duplicate service in templates/service.yaml to be reported, got %s", msg)
+	}
+}
+
 func TestValidateListAnnotations(t *testing.T) {
 	md := &K8sYamlStruct{
 		APIVersion: "v1",